@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// назначение одноразовых токенов из писем
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+)
+
+// срок действия ссылок из писем
+const (
+	verifyEmailTTL   = 48 * time.Hour
+	resetPasswordTTL = time.Hour
+)
+
+// bcrypt учитывает только первые 72 байта пароля
+const maxPasswordBytes = 72
+
+// Одноразовый токен подтверждения email или сброса пароля, хранится только хэш
+type UserToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"userId" gorm:"index"`
+	Purpose   string     `json:"purpose" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required"`
+}
+
+// Требования к паролю: минимальная длина и список утекших паролей из файла
+type PasswordPolicy struct {
+	MinLength int
+	breached  map[string]bool
+}
+
+var passwordPolicy = PasswordPolicy{MinLength: 8}
+
+var errTokenInvalid = errors.New("Ссылка недействительна или устарела")
+
+// загрузка политики; в файле по одному паролю в строке, строки с # пропускаются
+func loadPasswordPolicy(cfg AuthConfig) (PasswordPolicy, error) {
+	policy := PasswordPolicy{MinLength: cfg.PasswordMinLength, breached: map[string]bool{}}
+	if cfg.BreachedPasswordsFile == "" {
+		return policy, nil
+	}
+	file, err := os.Open(cfg.BreachedPasswordsFile)
+	if err != nil {
+		return policy, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		policy.breached[strings.ToLower(line)] = true
+	}
+	return policy, scanner.Err()
+}
+
+func (p PasswordPolicy) validate(password, username, email string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("Пароль должен содержать не менее %d символов", p.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("Пароль длиннее %d байт", maxPasswordBytes)
+	}
+	lower := strings.ToLower(password)
+	if lower == strings.ToLower(username) || (email != "" && lower == strings.ToLower(email)) {
+		return errors.New("Пароль не должен совпадать с именем пользователя или email")
+	}
+	if p.breached[lower] {
+		return errors.New("Пароль найден в списке утекших паролей, выберите другой")
+	}
+	return nil
+}
+
+// новый одноразовый токен; прежние неиспользованные токены того же назначения отменяются
+func issueUserToken(db *gorm.DB, userID uint, purpose string, ttl time.Duration) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&UserToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: hashToken(token),
+			ExpiresAt: now.Add(ttl),
+			CreatedAt: now,
+		}).Error
+	})
+	return token, err
+}
+
+// погашение токена: повторно и после истечения срока токен не принимается
+func consumeUserToken(tx *gorm.DB, token, purpose string) (User, error) {
+	var user User
+	var userToken UserToken
+	if err := tx.Where("token_hash = ? AND purpose = ?", hashToken(token), purpose).First(&userToken).Error; err != nil {
+		return user, errTokenInvalid
+	}
+	if userToken.UsedAt != nil || time.Now().After(userToken.ExpiresAt) {
+		return user, errTokenInvalid
+	}
+	result := tx.Model(&UserToken{}).Where("id = ? AND used_at IS NULL", userToken.ID).Update("used_at", time.Now())
+	if result.Error != nil {
+		return user, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return user, errTokenInvalid
+	}
+	if err := tx.First(&user, userToken.UserID).Error; err != nil {
+		return user, errTokenInvalid
+	}
+	return user, nil
+}
+
+func appLink(appURL, path, token string) string {
+	return strings.TrimRight(appURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+func sendVerificationEmail(db *gorm.DB, cfg AuthConfig, user User) error {
+	token, err := issueUserToken(db, user.ID, TokenPurposeVerifyEmail, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(Email{
+		To:      user.Email,
+		Subject: "Подтверждение email",
+		Body: "Здравствуйте, " + user.FullName + "!\n\n" +
+			"Для подтверждения адреса перейдите по ссылке:\n" +
+			appLink(cfg.AppURL, "/verify-email", token) + "\n\n" +
+			"Ссылка действует 48 часов.",
+	})
+}
+
+func sendPasswordResetEmail(db *gorm.DB, cfg AuthConfig, user User) error {
+	token, err := issueUserToken(db, user.ID, TokenPurposeResetPassword, resetPasswordTTL)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(Email{
+		To:      user.Email,
+		Subject: "Восстановление пароля",
+		Body: "Здравствуйте, " + user.FullName + "!\n\n" +
+			"Для установки нового пароля перейдите по ссылке:\n" +
+			appLink(cfg.AppURL, "/reset-password", token) + "\n\n" +
+			"Ссылка действует 1 час. Если вы не запрашивали восстановление, проигнорируйте письмо.",
+	})
+}
+
+func setPassword(tx *gorm.DB, user *User, password string) error {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = string(passwordHash)
+	user.MustChangePassword = false
+	return tx.Model(user).Select("password", "must_change_password").Updates(user).Error
+}
+
+// маршруты, доступные пользователю до смены одноразового пароля
+var passwordChangeAllowedPaths = map[string]bool{
+	"/api/auth/change-password": true,
+	"/api/auth/logout":          true,
+	"/api/auth/check":           true,
+}
+
+func SetupAccountRoutes(r *gin.Engine, db *gorm.DB, cfg AuthConfig) {
+
+	// подтверждение email по ссылке из письма
+	r.POST("/api/auth/verify-email", func(c *gin.Context) {
+		var req VerifyEmailRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			user, err := consumeUserToken(tx, req.Token, TokenPurposeVerifyEmail)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&user).Update("email_verified", true).Error; err != nil {
+				return err
+			}
+			// после подтверждения email можно привязать карточку клиента, заведенную автосалоном
+			user.EmailVerified = true
+			return linkCustomer(tx, &user)
+		})
+		if errors.Is(err, errTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при подтверждении email"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Email подтвержден"})
+	})
+
+	// повторная отправка письма с подтверждением
+	r.POST("/api/auth/resend-verification", authMiddleware(), func(c *gin.Context) {
+		var user User
+		if err := db.First(&user, c.GetUint("userId")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+			return
+		}
+		if user.EmailVerified {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email уже подтвержден"})
+			return
+		}
+		if user.Email == "" {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "У пользователя не указан email"})
+			return
+		}
+		if err := sendVerificationEmail(db, cfg, user); err != nil {
+			log.Println("Ошибка отправки письма:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось отправить письмо"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Письмо с подтверждением отправлено"})
+	})
+
+	// запрос на восстановление пароля; ответ не раскрывает, есть ли такой email
+	r.POST("/api/auth/forgot-password", func(c *gin.Context) {
+		var req ForgotPasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var user User
+		if err := db.Where("LOWER(email) = LOWER(?)", req.Email).First(&user).Error; err == nil {
+			if err := sendPasswordResetEmail(db, cfg, user); err != nil {
+				log.Println("Ошибка отправки письма:", err)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Если адрес зарегистрирован, на него отправлено письмо со ссылкой для восстановления"})
+	})
+
+	// установка нового пароля по ссылке из письма, все сессии пользователя завершаются
+	r.POST("/api/auth/reset-password", func(c *gin.Context) {
+		var req ResetPasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var policyErr error
+		err := db.Transaction(func(tx *gorm.DB) error {
+			user, err := consumeUserToken(tx, req.Token, TokenPurposeResetPassword)
+			if err != nil {
+				return err
+			}
+			if policyErr = passwordPolicy.validate(req.Password, user.Username, user.Email); policyErr != nil {
+				return policyErr
+			}
+			if err := setPassword(tx, &user, req.Password); err != nil {
+				return err
+			}
+			// ссылка пришла на этот адрес, значит он подтвержден
+			if err := tx.Model(&user).Update("email_verified", true).Error; err != nil {
+				return err
+			}
+			return revokeUserSessions(tx, user.ID)
+		})
+		if errors.Is(err, errTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if policyErr != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": policyErr.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при смене пароля"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Пароль изменен, войдите с новым паролем"})
+	})
+
+	// смена пароля авторизованным пользователем, остальные его сессии завершаются
+	r.POST("/api/auth/change-password", authMiddleware(), func(c *gin.Context) {
+		var req ChangePasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var user User
+		if err := db.First(&user, c.GetUint("userId")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.CurrentPassword)) != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверный текущий пароль"})
+			return
+		}
+		if req.NewPassword == req.CurrentPassword {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Новый пароль совпадает с текущим"})
+			return
+		}
+		if err := passwordPolicy.validate(req.NewPassword, user.Username, user.Email); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := setPassword(tx, &user, req.NewPassword); err != nil {
+				return err
+			}
+			return tx.Model(&Session{}).
+				Where("user_id = ? AND id <> ? AND revoked_at IS NULL", user.ID, c.GetString("sessionId")).
+				Update("revoked_at", time.Now()).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при смене пароля"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Пароль изменен"})
+	})
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Запись журнала изменений: каждая запись содержит хэш предыдущей,
+// поэтому правка или удаление любой записи обнаруживается проверкой цепочки
+type AuditEntry struct {
+	ID         uint          `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time     `json:"createdAt" gorm:"index"`
+	Actor      string        `json:"actor" gorm:"index"`
+	ActorRole  string        `json:"actorRole"`
+	Method     string        `json:"method"`
+	Route      string        `json:"route"`
+	Path       string        `json:"path"`
+	Status     int           `json:"status"`
+	EntityType string        `json:"entityType" gorm:"index:idx_audit_entity"`
+	EntityID   string        `json:"entityId" gorm:"index:idx_audit_entity"`
+	ShopID     *uint         `json:"shopId" gorm:"index"`
+	Before     AuditSnapshot `json:"before"`
+	After      AuditSnapshot `json:"after"`
+	IP         string        `json:"ip"`
+	PrevHash   string        `json:"prevHash"`
+	Hash       string        `json:"hash" gorm:"uniqueIndex"`
+}
+
+// снимок строки в JSON, хранится текстом и отдается как объект
+type AuditSnapshot string
+
+func (s AuditSnapshot) MarshalJSON() ([]byte, error) {
+	if s == "" {
+		return []byte("null"), nil
+	}
+	// испорченный снимок отдаем строкой, чтобы журнал оставался читаемым
+	if !json.Valid([]byte(s)) {
+		return json.Marshal(string(s))
+	}
+	return []byte(s), nil
+}
+
+// результат проверки цепочки
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	BrokenAt *uint  `json:"brokenAt,omitempty"`
+	LastHash string `json:"lastHash"`
+	// изменения с момента запуска, которые не удалось записать в журнал
+	Unrecorded int64 `json:"unrecorded"`
+}
+
+// сущности, для которых сохраняются снимки строки до и после изменения
+var auditEntities = map[string]interface{}{
+	"cars":             &Car{},
+	"shops":            &Shop{},
+	"brands":           &CarBrand{},
+	"models":           &CarModel{},
+	"customers":        &Customer{},
+	"employees":        &Employee{},
+	"sales":            &Sale{},
+	"finance-options":  &FinanceOption{},
+	"service-profiles": &ServiceProfile{},
+	"transport-tax":    &TransportTaxRegion{},
+	"tariffs":          &TariffTable{},
+	"exchange-rates":   &ExchangeRate{},
+	"users":            &User{},
+	"login-locks":      &LoginLock{},
+}
+
+// POST-маршруты, которые ничего не меняют
+var auditSkipRoutes = map[string]bool{
+	"/api/admin/cars/decode-vin": true,
+}
+
+// столбцы, которые не попадают в журнал
+var auditRedactedColumns = []string{"password", "totp_secret", "totp_last_step", "token_version"}
+
+var errAuditChainBroken = errors.New("цепочка журнала нарушена")
+
+// записи добавляются по одной, чтобы цепочка хэшей не разветвлялась
+var auditMu sync.Mutex
+
+// число изменений, не попавших в журнал, отдается в проверке журнала
+var auditFailures atomic.Int64
+
+// ответ обработчика задерживается до записи в журнал: ID созданной записи
+// берется из ответа, а при ошибке журнала клиент вместо успеха получает 500
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *auditResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// заголовки отправляются вместе с телом в flush
+func (w *auditResponseWriter) WriteHeaderNow() {}
+
+func (w *auditResponseWriter) flush() {
+	w.ResponseWriter.WriteHeaderNow()
+	w.ResponseWriter.Write(w.body.Bytes())
+}
+
+// тип сущности по маршруту: /api/admin/cars/:id -> cars
+func auditEntityType(route string) string {
+	rest := strings.TrimPrefix(route, "/api/admin/")
+	if i := strings.Index(rest, "/"); i >= 0 {
+		return rest[:i]
+	}
+	return rest
+}
+
+// снимок строки таблицы, в том числе удаленной
+func auditSnapshot(db *gorm.DB, entityType, id string) (AuditSnapshot, map[string]interface{}) {
+	model, ok := auditEntities[entityType]
+	if !ok || id == "" {
+		return "", nil
+	}
+	row := map[string]interface{}{}
+	if err := db.Unscoped().Model(model).Where("id = ?", id).Take(&row).Error; err != nil {
+		return "", nil
+	}
+	for _, column := range auditRedactedColumns {
+		delete(row, column)
+	}
+	data, err := json.Marshal(row)
+	if err != nil {
+		return "", nil
+	}
+	return AuditSnapshot(data), row
+}
+
+func auditShopID(rows ...map[string]interface{}) *uint {
+	for _, row := range rows {
+		switch v := row["shop_id"].(type) {
+		case uint:
+			return &v
+		case *uint:
+			if v != nil {
+				return v
+			}
+		case int64:
+			id := uint(v)
+			return &id
+		case float64:
+			id := uint(v)
+			return &id
+		}
+	}
+	return nil
+}
+
+// хэш записи вместе с хэшем предыдущей
+func (e AuditEntry) computeHash() string {
+	data, _ := json.Marshal(struct {
+		ID         uint   `json:"id"`
+		CreatedAt  string `json:"createdAt"`
+		Actor      string `json:"actor"`
+		ActorRole  string `json:"actorRole"`
+		Method     string `json:"method"`
+		Route      string `json:"route"`
+		Path       string `json:"path"`
+		Status     int    `json:"status"`
+		EntityType string `json:"entityType"`
+		EntityID   string `json:"entityId"`
+		ShopID     *uint  `json:"shopId"`
+		Before     string `json:"before"`
+		After      string `json:"after"`
+		IP         string `json:"ip"`
+		PrevHash   string `json:"prevHash"`
+	}{e.ID, e.CreatedAt.UTC().Format(time.RFC3339Nano), e.Actor, e.ActorRole, e.Method, e.Route, e.Path,
+		e.Status, e.EntityType, e.EntityID, e.ShopID, string(e.Before), string(e.After), e.IP, e.PrevHash})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// добавление записи в конец цепочки
+func appendAuditEntry(db *gorm.DB, entry AuditEntry) error {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	var last AuditEntry
+	if err := db.Order("id DESC").Limit(1).Find(&last).Error; err != nil {
+		return err
+	}
+	entry.ID = last.ID + 1
+	entry.PrevHash = last.Hash
+	entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	entry.Hash = entry.computeHash()
+	return db.Create(&entry).Error
+}
+
+// запрет изменения и удаления записей журнала на уровне базы
+func protectAuditLog(db *gorm.DB) error {
+	for _, op := range []string{"UPDATE", "DELETE"} {
+		err := db.Exec("CREATE TRIGGER IF NOT EXISTS audit_entries_no_" + strings.ToLower(op) +
+			" BEFORE " + op + " ON audit_entries BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END").Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// мидлварь журнала: снимок до изменения, выполнение обработчика, снимок после;
+// записываются только успешные изменения
+func auditMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead ||
+			c.Request.Method == http.MethodOptions || route == "" || auditSkipRoutes[route] {
+			c.Next()
+			return
+		}
+
+		entityType := auditEntityType(route)
+		entityID := c.Param("id")
+		before, beforeRow := auditSnapshot(db, entityType, entityID)
+
+		writer := &auditResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		status := writer.Status()
+		if status >= http.StatusBadRequest {
+			writer.flush()
+			return
+		}
+
+		// ID созданной записи берем из ответа
+		if entityID == "" {
+			var created struct {
+				ID uint `json:"id"`
+			}
+			if json.Unmarshal(writer.body.Bytes(), &created) == nil && created.ID > 0 {
+				entityID = strconv.FormatUint(uint64(created.ID), 10)
+			}
+		}
+		after, afterRow := auditSnapshot(db, entityType, entityID)
+		// для импорта и настроек без ID сохраняем ответ обработчика
+		if after == "" && entityID == "" && json.Valid(writer.body.Bytes()) {
+			after = AuditSnapshot(writer.body.String())
+		}
+
+		shopID := auditShopID(afterRow, beforeRow)
+		if shopID == nil {
+			if id, scoped := shopScope(c); scoped {
+				shopID = &id
+			}
+		}
+
+		err := appendAuditEntry(db, AuditEntry{
+			Actor:      c.GetString("username"),
+			ActorRole:  c.GetString("role"),
+			Method:     c.Request.Method,
+			Route:      route,
+			Path:       c.Request.URL.Path,
+			Status:     status,
+			EntityType: entityType,
+			EntityID:   entityID,
+			ShopID:     shopID,
+			Before:     before,
+			After:      after,
+			IP:         c.ClientIP(),
+		})
+		if err != nil {
+			// изменение уже сохранено, но без записи в журнале: сообщаем клиенту и в лог
+			auditFailures.Add(1)
+			log.Printf("ВНИМАНИЕ: изменение %s %s не записано в журнал изменений: %v", c.Request.Method, c.Request.URL.Path, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Изменение выполнено, но не записано в журнал изменений"})
+			return
+		}
+		writer.flush()
+	}
+}
+
+// проверка цепочки хэшей от первой записи до последней
+func verifyAuditLog(db *gorm.DB) (AuditVerification, error) {
+	result := AuditVerification{Valid: true, Unrecorded: auditFailures.Load()}
+	var batch []AuditEntry
+	err := db.Order("id").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, entry := range batch {
+			if entry.PrevHash != result.LastHash || entry.computeHash() != entry.Hash {
+				id := entry.ID
+				result.Valid = false
+				result.BrokenAt = &id
+				return errAuditChainBroken
+			}
+			result.LastHash = entry.Hash
+			result.Checked++
+		}
+		return nil
+	}).Error
+	if errors.Is(err, errAuditChainBroken) {
+		err = nil
+	}
+	return result, err
+}
+
+func SetupAuditRoutes(auditRoutes *gin.RouterGroup, db *gorm.DB) {
+
+	// журнал изменений с фильтрами
+	auditRoutes.GET("/audit", func(c *gin.Context) {
+		query := scopeToShop(c, db.Order("id DESC"), "shop_id")
+		for param, column := range map[string]string{
+			"actor":      "actor",
+			"entityType": "entity_type",
+			"entityId":   "entity_id",
+			"method":     "method",
+			"route":      "route",
+		} {
+			if value := c.Query(param); value != "" {
+				query = query.Where(column+" = ?", value)
+			}
+		}
+		for param, op := range map[string]string{"from": ">=", "to": "<"} {
+			value := c.Query(param)
+			if value == "" {
+				continue
+			}
+			date, err := time.Parse(tariffDateLayout, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Дата " + param + " должна быть в формате 2006-01-02"})
+				return
+			}
+			// to включает указанный день
+			if param == "to" {
+				date = date.AddDate(0, 0, 1)
+			}
+			query = query.Where("created_at "+op+" ?", date)
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit < 1 || limit > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit должен быть от 1 до 1000"})
+			return
+		}
+		if beforeID := c.Query("beforeId"); beforeID != "" {
+			query = query.Where("id < ?", beforeID)
+		}
+
+		var entries []AuditEntry
+		query.Limit(limit).Find(&entries)
+		c.JSON(http.StatusOK, entries)
+	})
+
+	// проверка целостности журнала
+	auditRoutes.GET("/audit/verify", func(c *gin.Context) {
+		result, err := verifyAuditLog(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки журнала"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// база в памяти и маршруты марок под мидлварью журнала
+func newAuditTestServer(t *testing.T) (*gorm.DB, *gin.Engine) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// у каждого соединения своя база в памяти
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&CarBrand{}, &AuditEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := protectAuditLog(db); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	admin := r.Group("/api/admin", func(c *gin.Context) {
+		c.Set("username", "owner")
+		c.Set("role", RoleOwner)
+	}, auditMiddleware(db))
+	admin.POST("/brands", func(c *gin.Context) {
+		brand := CarBrand{Name: "Lada"}
+		if err := db.Create(&brand).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, brand)
+	})
+	admin.PUT("/brands/:id", func(c *gin.Context) {
+		if err := db.Model(&CarBrand{}).Where("id = ?", c.Param("id")).Update("name", "LADA").Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Марка обновлена"})
+	})
+	return db, r
+}
+
+func auditRequest(r *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestAuditMiddlewareChainsEntries(t *testing.T) {
+	db, r := newAuditTestServer(t)
+
+	if w := auditRequest(r, http.MethodPost, "/api/admin/brands"); w.Code != http.StatusCreated {
+		t.Fatalf("создание: статус %d, тело %s", w.Code, w.Body)
+	}
+	if w := auditRequest(r, http.MethodPut, "/api/admin/brands/1"); w.Code != http.StatusOK {
+		t.Fatalf("изменение: статус %d, тело %s", w.Code, w.Body)
+	}
+
+	var entries []AuditEntry
+	if err := db.Order("id").Find(&entries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("записей в журнале %d, ожидалось 2", len(entries))
+	}
+	if entries[0].PrevHash != "" || entries[1].PrevHash != entries[0].Hash {
+		t.Error("записи не связаны хэшами")
+	}
+	if entries[0].EntityID != "1" || !strings.Contains(string(entries[0].After), `"Lada"`) {
+		t.Errorf("создание записано как %s %s", entries[0].EntityID, entries[0].After)
+	}
+	if !strings.Contains(string(entries[1].Before), `"Lada"`) || !strings.Contains(string(entries[1].After), `"LADA"`) {
+		t.Errorf("изменение записано как %s -> %s", entries[1].Before, entries[1].After)
+	}
+
+	result, err := verifyAuditLog(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid || result.Checked != 2 || result.LastHash != entries[1].Hash {
+		t.Fatalf("проверка целой цепочки: %+v", result)
+	}
+
+	if err := db.Exec("UPDATE audit_entries SET actor = 'intruder' WHERE id = 1").Error; err == nil {
+		t.Fatal("триггер не запретил изменение записи журнала")
+	}
+	// подмена в обход триггера, как при прямой правке файла базы
+	if err := db.Exec("DROP TRIGGER audit_entries_no_update").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("UPDATE audit_entries SET actor = 'intruder' WHERE id = 1").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = verifyAuditLog(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid || result.BrokenAt == nil || *result.BrokenAt != 1 {
+		t.Fatalf("подмена не обнаружена: %+v", result)
+	}
+}
+
+// изменение без записи в журнале не должно выглядеть успешным
+func TestAuditMiddlewareFailsWithoutEntry(t *testing.T) {
+	db, r := newAuditTestServer(t)
+	if err := db.Migrator().DropTable(&AuditEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	failures := auditFailures.Load()
+
+	w := auditRequest(r, http.MethodPost, "/api/admin/brands")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("статус %d, ожидался 500", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "Lada") {
+		t.Errorf("клиент получил ответ обработчика: %s", w.Body)
+	}
+	if auditFailures.Load() != failures+1 {
+		t.Error("сбой журнала не учтен")
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// секрет из прежних версий, допустим только в режиме разработки
+const devJWTSecret = "secret_key_autosalon_2023"
+
+// минимальная длина секрета HS256 вне режима разработки
+const minJWTSecretLength = 32
+
+// ключ подписи токенов; ключ без закрытой части только проверяет
+// токены, выданные до смены ключа
+type SigningKeyConfig struct {
+	Kid            string `json:"kid" yaml:"kid"`
+	Algorithm      string `json:"algorithm" yaml:"algorithm"`
+	Secret         string `json:"secret" yaml:"secret"`
+	PrivateKeyFile string `json:"privateKeyFile" yaml:"privateKeyFile"`
+	PublicKeyFile  string `json:"publicKeyFile" yaml:"publicKeyFile"`
+}
+
+// Настройки авторизации: файл AUTH_CONFIG_FILE (YAML или JSON),
+// переменные окружения переопределяют значения из файла
+type AuthConfig struct {
+	Env           string             `json:"env" yaml:"env"`
+	JWTSecret     string             `json:"jwtSecret" yaml:"jwtSecret"`
+	SigningKeys   []SigningKeyConfig `json:"signingKeys" yaml:"signingKeys"`
+	ActiveKid     string             `json:"activeKid" yaml:"activeKid"`
+	AdminUsername string             `json:"adminUsername" yaml:"adminUsername"`
+	AdminPassword string             `json:"adminPassword" yaml:"adminPassword"`
+
+	// адрес фронтенда для ссылок в письмах
+	AppURL                string     `json:"appUrl" yaml:"appUrl"`
+	PasswordMinLength     int        `json:"passwordMinLength" yaml:"passwordMinLength"`
+	BreachedPasswordsFile string     `json:"breachedPasswordsFile" yaml:"breachedPasswordsFile"`
+	Mail                  MailConfig `json:"mail" yaml:"mail"`
+
+	Lockout LockoutConfig `json:"lockout" yaml:"lockout"`
+}
+
+func (cfg AuthConfig) isDev() bool {
+	switch strings.ToLower(cfg.Env) {
+	case "dev", "development", "local":
+		return true
+	}
+	return false
+}
+
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	sign   interface{}
+	verify interface{}
+}
+
+// набор ключей: активным подписываются новые токены, остальные принимаются по kid
+type keyring struct {
+	active *signingKey
+	byKid  map[string]*signingKey
+}
+
+var signingKeys keyring
+
+func loadAuthConfig() (AuthConfig, error) {
+	var cfg AuthConfig
+	if path := os.Getenv("AUTH_CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("не удалось разобрать файл настроек авторизации: %w", err)
+		}
+		// пути к ключам указываются относительно файла настроек
+		dir := filepath.Dir(path)
+		for i := range cfg.SigningKeys {
+			cfg.SigningKeys[i].PrivateKeyFile = resolvePath(dir, cfg.SigningKeys[i].PrivateKeyFile)
+			cfg.SigningKeys[i].PublicKeyFile = resolvePath(dir, cfg.SigningKeys[i].PublicKeyFile)
+		}
+		cfg.BreachedPasswordsFile = resolvePath(dir, cfg.BreachedPasswordsFile)
+	}
+
+	overrides := map[string]*string{
+		"APP_ENV":        &cfg.Env,
+		"JWT_SECRET":     &cfg.JWTSecret,
+		"JWT_ACTIVE_KID": &cfg.ActiveKid,
+		"ADMIN_USERNAME": &cfg.AdminUsername,
+		"ADMIN_PASSWORD": &cfg.AdminPassword,
+
+		"APP_URL":                 &cfg.AppURL,
+		"BREACHED_PASSWORDS_FILE": &cfg.BreachedPasswordsFile,
+		"MAIL_TRANSPORT":          &cfg.Mail.Transport,
+		"MAIL_FROM":               &cfg.Mail.From,
+		"MAIL_OUTBOX_DIR":         &cfg.Mail.OutboxDir,
+		"SMTP_HOST":               &cfg.Mail.SMTPHost,
+		"SMTP_PORT":               &cfg.Mail.SMTPPort,
+		"SMTP_USERNAME":           &cfg.Mail.SMTPUsername,
+		"SMTP_PASSWORD":           &cfg.Mail.SMTPPassword,
+
+		"LOGIN_LOCKOUT":        &cfg.Lockout.Duration,
+		"LOGIN_LOCKOUT_MAX":    &cfg.Lockout.MaxDuration,
+		"LOGIN_FAILURE_WINDOW": &cfg.Lockout.Window,
+	}
+	for name, field := range overrides {
+		if value := os.Getenv(name); value != "" {
+			*field = value
+		}
+	}
+	intOverrides := map[string]*int{
+		"PASSWORD_MIN_LENGTH":   &cfg.PasswordMinLength,
+		"LOGIN_MAX_FAILURES":    &cfg.Lockout.MaxFailures,
+		"LOGIN_IP_MAX_FAILURES": &cfg.Lockout.IPMaxFailures,
+	}
+	for name, field := range intOverrides {
+		if value := os.Getenv(name); value != "" {
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				return cfg, fmt.Errorf("некорректное значение %s: %s", name, value)
+			}
+			*field = number
+		}
+	}
+	if cfg.Env == "" {
+		cfg.Env = "production"
+	}
+	if cfg.AdminUsername == "" {
+		cfg.AdminUsername = "admin"
+	}
+	if cfg.AppURL == "" {
+		cfg.AppURL = "http://localhost"
+	}
+	if cfg.PasswordMinLength == 0 {
+		cfg.PasswordMinLength = 8
+	}
+	if cfg.Mail.From == "" {
+		cfg.Mail.From = "noreply@localhost"
+	}
+	return cfg, nil
+}
+
+func resolvePath(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// сборка набора ключей; вне режима разработки известный секрет и короткие секреты запрещены
+func buildKeyring(cfg AuthConfig) (keyring, error) {
+	ring := keyring{byKid: map[string]*signingKey{}}
+
+	keys := cfg.SigningKeys
+	if cfg.JWTSecret != "" {
+		keys = append(keys, SigningKeyConfig{Kid: "default", Algorithm: "HS256", Secret: cfg.JWTSecret})
+	}
+	if len(keys) == 0 {
+		if !cfg.isDev() {
+			return ring, errors.New("не задан ключ подписи токенов: укажите JWT_SECRET или signingKeys в AUTH_CONFIG_FILE")
+		}
+		log.Println("ВНИМАНИЕ: используется секрет JWT для разработки, не используйте его в рабочем окружении")
+		keys = append(keys, SigningKeyConfig{Kid: "dev", Algorithm: "HS256", Secret: devJWTSecret})
+	}
+
+	for _, keyCfg := range keys {
+		if keyCfg.Kid == "" {
+			return ring, errors.New("у ключа подписи не указан kid")
+		}
+		if _, exists := ring.byKid[keyCfg.Kid]; exists {
+			return ring, fmt.Errorf("ключ %s указан дважды", keyCfg.Kid)
+		}
+		if !cfg.isDev() && keyCfg.Secret != "" {
+			if keyCfg.Secret == devJWTSecret {
+				return ring, fmt.Errorf("ключ %s: известный секрет по умолчанию допустим только при APP_ENV=dev", keyCfg.Kid)
+			}
+			if len(keyCfg.Secret) < minJWTSecretLength {
+				return ring, fmt.Errorf("ключ %s: секрет короче %d символов", keyCfg.Kid, minJWTSecretLength)
+			}
+		}
+		key, err := parseSigningKey(keyCfg)
+		if err != nil {
+			return ring, fmt.Errorf("ключ %s: %w", keyCfg.Kid, err)
+		}
+		ring.byKid[key.kid] = key
+	}
+
+	activeKid := cfg.ActiveKid
+	if activeKid == "" {
+		activeKid = keys[0].Kid
+	}
+	active, ok := ring.byKid[activeKid]
+	if !ok {
+		return ring, fmt.Errorf("активный ключ %s не найден", activeKid)
+	}
+	if active.sign == nil {
+		return ring, fmt.Errorf("у активного ключа %s нет закрытой части", activeKid)
+	}
+	ring.active = active
+	return ring, nil
+}
+
+func parseSigningKey(cfg SigningKeyConfig) (*signingKey, error) {
+	key := &signingKey{kid: cfg.Kid}
+	switch strings.ToUpper(cfg.Algorithm) {
+	case "", "HS256":
+		if cfg.Secret == "" {
+			return nil, errors.New("для HS256 нужен secret")
+		}
+		key.method = jwt.SigningMethodHS256
+		key.sign = []byte(cfg.Secret)
+		key.verify = key.sign
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+		if cfg.PrivateKeyFile != "" {
+			data, err := os.ReadFile(cfg.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			key.sign = private
+			key.verify = &private.PublicKey
+		} else if cfg.PublicKeyFile != "" {
+			data, err := os.ReadFile(cfg.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			public, err := jwt.ParseRSAPublicKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			key.verify = public
+		}
+	case "EDDSA", "ED25519":
+		key.method = jwt.SigningMethodEdDSA
+		if cfg.PrivateKeyFile != "" {
+			data, err := os.ReadFile(cfg.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			private, err := jwt.ParseEdPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			key.sign = private
+			key.verify = private.(ed25519.PrivateKey).Public()
+		} else if cfg.PublicKeyFile != "" {
+			data, err := os.ReadFile(cfg.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			public, err := jwt.ParseEdPublicKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			key.verify = public
+		}
+	default:
+		return nil, fmt.Errorf("неподдерживаемый алгоритм %s", cfg.Algorithm)
+	}
+	if key.verify == nil {
+		return nil, errors.New("нужен privateKeyFile или publicKeyFile")
+	}
+	return key, nil
+}
+
+// подпись токена активным ключом с его kid в заголовке
+func (ring keyring) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ring.active.method, claims)
+	token.Header["kid"] = ring.active.kid
+	return token.SignedString(ring.active.sign)
+}
+
+// выбор ключа проверки по kid; алгоритм токена должен совпадать с алгоритмом ключа
+func (ring keyring) keyFunc(token *jwt.Token) (interface{}, error) {
+	key := ring.active
+	if kid, ok := token.Header["kid"].(string); ok {
+		if key, ok = ring.byKid[kid]; !ok {
+			return nil, fmt.Errorf("неизвестный ключ %s", kid)
+		}
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("алгоритм %s не соответствует ключу %s", token.Method.Alg(), key.kid)
+	}
+	return key.verify, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxCompareCalculations = 10
+
+// сохраненный расчет с пересчетом по текущим условиям
+type CostCalculationView struct {
+	CostCalculation
+	Customer CustomerView `json:"customer"`
+
+	// платеж по условиям на момент расчета, пересчитанный заново
+	SavedPayment *Money `json:"savedPayment"`
+	// платеж по текущим условиям и текущей цене автомобиля
+	CurrentPayment  *Money       `json:"currentPayment"`
+	CurrentErrors   []FieldError `json:"currentErrors,omitempty"`
+	CurrentCarPrice Money        `json:"currentCarPrice"`
+	CurrentTerms    FinanceTerms `json:"currentTerms"`
+
+	// для старых расчетов условия не сохранялись
+	TermsKnown   bool     `json:"termsKnown"`
+	ChangedTerms []string `json:"changedTerms"`
+	PriceChanged bool     `json:"priceChanged"`
+}
+
+// ежемесячный платеж по расчету с заданными условиями
+func recalculatePayment(calc CostCalculation, option FinanceOption, carPrice Money) (*Money, []FieldError) {
+	if errs := validateFinanceRequest(option, carPrice, calc.DownPayment, calc.TradeInValue, calc.LoanTerm); len(errs) > 0 {
+		return nil, errs
+	}
+	financed := carPrice - calc.DownPayment - calc.TradeInValue
+	plan, err := buildFinancePlan(option, carPrice, financed, calc.LoanTerm, 0)
+	if err != nil {
+		// платеж не рассчитывается, например при слишком малой сумме финансирования
+		return nil, []FieldError{{Field: "downPayment", Rule: "payment", Message: err.Error()}}
+	}
+	return &plan.MonthlyPayment, nil
+}
+
+func buildCostCalculationView(calc CostCalculation, contacts bool) CostCalculationView {
+	view := CostCalculationView{
+		CostCalculation: calc,
+		Customer:        customerViewOf(calc.Customer, contacts),
+		CurrentCarPrice: calc.Car.Price,
+		CurrentTerms:    financeTermsOf(calc.FinanceOption),
+		TermsKnown:      calc.Terms.ProductType != "",
+		ChangedTerms:    []string{},
+	}
+
+	view.CurrentPayment, view.CurrentErrors = recalculatePayment(calc, calc.FinanceOption, calc.Car.Price)
+
+	if view.TermsKnown {
+		view.ChangedTerms = calc.Terms.changed(view.CurrentTerms)
+		view.PriceChanged = calc.CarPrice != calc.Car.Price
+		view.SavedPayment, _ = recalculatePayment(calc, calc.Terms.apply(calc.FinanceOption), calc.CarPrice)
+	}
+	return view
+}
+
+func costCalculationsQuery(db *gorm.DB) *gorm.DB {
+	return db.Preload("Car", withDeleted).Preload("Car.Brand").Preload("Car.Model").
+		Preload("Customer", withDeleted).Preload("FinanceOption")
+}
+
+// расчеты по автомобилям автосалона пользователя
+func scopeCalculationsToShop(c *gin.Context, db, query *gorm.DB) *gorm.DB {
+	if _, scoped := shopScope(c); !scoped {
+		return query
+	}
+	cars := scopeToShop(c, db.Unscoped().Model(&Car{}).Select("id"), "shop_id")
+	return query.Where("car_id IN (?)", cars)
+}
+
+// список расчетов по клиенту или автомобилю
+func listCostCalculations(c *gin.Context) {
+	db, ok := c.MustGet("db").(*gorm.DB)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "База данных недоступна"})
+		return
+	}
+
+	query := scopeCalculationsToShop(c, db, costCalculationsQuery(db)).Order("created_at DESC")
+	if customerID := c.Query("customerId"); customerID != "" {
+		query = query.Where("customer_id = ?", customerID)
+	}
+	if carID := c.Query("carId"); carID != "" {
+		query = query.Where("car_id = ?", carID)
+	}
+
+	var calculations []CostCalculation
+	query.Find(&calculations)
+
+	contacts := canView(c, PermCustomersContacts)
+	result := make([]CostCalculationView, 0, len(calculations))
+	for _, calc := range calculations {
+		result = append(result, buildCostCalculationView(calc, contacts))
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// расчет по ID
+func getCostCalculation(c *gin.Context) {
+	db, ok := c.MustGet("db").(*gorm.DB)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "База данных недоступна"})
+		return
+	}
+
+	var calc CostCalculation
+	if err := scopeCalculationsToShop(c, db, costCalculationsQuery(db)).First(&calc, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Расчет не найден"})
+		return
+	}
+	c.JSON(http.StatusOK, buildCostCalculationView(calc, canView(c, PermCustomersContacts)))
+}
+
+// сравнение нескольких расчетов, ids=1,2,3
+func compareCostCalculations(c *gin.Context) {
+	db, ok := c.MustGet("db").(*gorm.DB)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "База данных недоступна"})
+		return
+	}
+
+	var ids []uint
+	for _, part := range strings.Split(c.Query("ids"), ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ID расчета: " + part})
+			return
+		}
+		ids = append(ids, uint(id))
+	}
+	if len(ids) < 2 || len(ids) > maxCompareCalculations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Для сравнения укажите от 2 до %d расчетов", maxCompareCalculations)})
+		return
+	}
+
+	var calculations []CostCalculation
+	scopeCalculationsToShop(c, db, costCalculationsQuery(db)).Where("id IN ?", ids).Find(&calculations)
+	byID := make(map[uint]CostCalculation, len(calculations))
+	for _, calc := range calculations {
+		byID[calc.ID] = calc
+	}
+
+	contacts := canView(c, PermCustomersContacts)
+	result := make([]CostCalculationView, 0, len(ids))
+	for _, id := range ids {
+		calc, found := byID[id]
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Расчет не найден: " + strconv.FormatUint(uint64(id), 10)})
+			return
+		}
+		result = append(result, buildCostCalculationView(calc, contacts))
+	}
+	c.JSON(http.StatusOK, result)
+}
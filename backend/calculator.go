@@ -2,7 +2,7 @@ package main
 
 import (
 	"net/http"
-	"time"
+	"strings"
 
 	"math"
 
@@ -12,36 +12,84 @@ import (
 
 // расчет импорта автомобиля
 type ImportCalculation struct {
-	CarPrice        float64 `json:"carPrice"`
+	CarPrice        Money   `json:"carPrice"`
 	CarYear         int     `json:"carYear"`
 	EngineVolume    float64 `json:"engineVolume"`
 	EnginePower     int     `json:"enginePower"`
 	Country         string  `json:"country"`
-	CustomsFee      float64 `json:"customsFee"`
-	ExciseTax       float64 `json:"exciseTax"`
-	VAT             float64 `json:"vat"`
-	UtilizationFee  float64 `json:"utilizationFee"`
-	RegistrationFee float64 `json:"registrationFee"`
-	TotalCost       float64 `json:"totalCost"`
+	FuelType        string  `json:"fuelType"`
+	BatteryCapacity float64 `json:"batteryCapacity"`
+	ElectricPower   int     `json:"electricPower"`
+	CustomsFee      Money   `json:"customsFee"`
+	ExciseTax       Money   `json:"exciseTax"`
+	VAT             Money   `json:"vat"`
+	UtilizationFee  Money   `json:"utilizationFee"`
+	RegistrationFee Money   `json:"registrationFee"`
+	TotalCost       Money   `json:"totalCost"`
+
+	// дата, на которую применяется тариф (2006-01-02), по умолчанию сегодня
+	Date       string `json:"date"`
+	TariffID   uint   `json:"tariffId"`
+	TariffName string `json:"tariffName"`
+
+	// валюта цены покупки, суммы сборов считаются в рублях
+	Currency         string          `json:"currency"`
+	ExchangeRate     float64         `json:"exchangeRate"`
+	ExchangeRateDate string          `json:"exchangeRateDate"`
+	CarPriceRub      Money           `json:"carPriceRub"`
+	Lines            []ImportFeeLine `json:"lines"`
+}
+
+// строка расчета импорта в рублях и в валюте покупки
+type ImportFeeLine struct {
+	Name           string `json:"name"`
+	Amount         Money  `json:"amount"`
+	OriginalAmount Money  `json:"originalAmount"`
 }
 
 // ежемесячный платеж
 type MonthlyPaymentRequest struct {
-	CarID           uint `json:"carId"`
-	CustomerID      uint `json:"customerId"`
-	FinanceOptionID uint `json:"financeOptionId"`
-	DownPayment     int  `json:"downPayment"`
-	LoanTerm        int  `json:"loanTerm"`
-	HasInsurance    bool `json:"hasInsurance"`
-	TradeInValue    int  `json:"tradeInValue"`
+	CarID           uint  `json:"carId"`
+	CustomerID      uint  `json:"customerId"`
+	FinanceOptionID uint  `json:"financeOptionId"`
+	DownPayment     Money `json:"downPayment"`
+	LoanTerm        int   `json:"loanTerm"`
+	HasInsurance    bool  `json:"hasInsurance"`
+	TradeInValue    Money `json:"tradeInValue"`
+	Schedule        bool  `json:"schedule"`
+
+	// ожидаемый годовой пробег для расчета перепробега по лизингу
+	YearlyMileage int `json:"yearlyMileage"`
 }
 
 type MonthlyPaymentResponse struct {
-	MonthlyLoanPayment  float64 `json:"monthlyLoanPayment"`
-	InsuranceCost       float64 `json:"insuranceCost"`
-	TotalMonthlyPayment float64 `json:"totalMonthlyPayment"`
-	TotalCost           float64 `json:"totalCost"`
-	CalculationID       uint    `json:"calculationId"`
+	MonthlyLoanPayment  Money `json:"monthlyLoanPayment"`
+	InsuranceCost       Money `json:"insuranceCost"`
+	TotalMonthlyPayment Money `json:"totalMonthlyPayment"`
+	TotalCost           Money `json:"totalCost"`
+	CalculationID       uint  `json:"calculationId"`
+
+	LoanAmount          Money                 `json:"loanAmount"`
+	TotalInterest       Money                 `json:"totalInterest"`
+	Overpayment         Money                 `json:"overpayment"`
+	EffectiveAnnualRate float64               `json:"effectiveAnnualRate"`
+	Schedule            []PaymentScheduleItem `json:"schedule,omitempty"`
+
+	ProductType       string `json:"productType"`
+	ResidualValue     Money  `json:"residualValue,omitempty"`
+	BalloonPayment    Money  `json:"balloonPayment,omitempty"`
+	ExcessMileageCost Money  `json:"excessMileageCost,omitempty"`
+}
+
+// строка графика платежей
+type PaymentScheduleItem struct {
+	Month            int   `json:"month"`
+	Payment          Money `json:"payment"`
+	InterestPart     Money `json:"interestPart"`
+	PrincipalPart    Money `json:"principalPart"`
+	InsurancePayment Money `json:"insurancePayment"`
+	EarlyRepayment   Money `json:"earlyRepayment,omitempty"`
+	RemainingBalance Money `json:"remainingBalance"`
 }
 
 // общая стоимость владения
@@ -49,16 +97,52 @@ type TotalCostRequest struct {
 	CarID         uint `json:"carId"`
 	LoanTerm      int  `json:"loanTerm"`
 	YearlyMileage int  `json:"yearlyMileage"`
+
+	// цена литра топлива или кВт·ч, по умолчанию берется средняя для типа силовой установки
+	EnergyPrice Money `json:"energyPrice"`
+	// код региона для транспортного налога
+	Region string `json:"region"`
+	// дата расчета в формате 2006-01-02, по умолчанию сегодня
+	AsOf string `json:"asOf"`
 }
 
 type TotalCostResponse struct {
-	InitialPrice     int     `json:"initialPrice"`
-	FuelCost         float64 `json:"fuelCost"`
-	ServiceCost      float64 `json:"serviceCost"`
-	TaxCost          float64 `json:"taxCost"`
-	InsuranceCost    float64 `json:"insuranceCost"`
-	TotalCost        float64 `json:"totalCost"`
+	InitialPrice     Money   `json:"initialPrice"`
+	FuelCost         Money   `json:"fuelCost"`
+	ServiceCost      Money   `json:"serviceCost"`
+	TaxCost          Money   `json:"taxCost"`
+	InsuranceCost    Money   `json:"insuranceCost"`
+	TotalCost        Money   `json:"totalCost"`
 	YearsOfOwnership float64 `json:"yearsOfOwnership"`
+
+	FuelType       string  `json:"fuelType"`
+	EnergyUnit     string  `json:"energyUnit"`
+	EnergyPrice    Money   `json:"energyPrice"`
+	EnergyConsumed float64 `json:"energyConsumed"`
+	Consumption    float64 `json:"consumption"`
+
+	ServiceProfile string `json:"serviceProfile"`
+	Region         string `json:"region"`
+	AsOf           string `json:"asOf"`
+
+	// потеря стоимости за срок, ожидаемая цена перепродажи и затраты за вычетом перепродажи
+	Depreciation Money           `json:"depreciation"`
+	ResaleValue  Money           `json:"resaleValue"`
+	NetCost      Money           `json:"netCost"`
+	Years        []TotalCostYear `json:"years"`
+}
+
+// затраты за один год владения, последний год может быть неполным
+type TotalCostYear struct {
+	Year          int   `json:"year"`
+	Months        int   `json:"months"`
+	FuelCost      Money `json:"fuelCost"`
+	ServiceCost   Money `json:"serviceCost"`
+	TaxCost       Money `json:"taxCost"`
+	InsuranceCost Money `json:"insuranceCost"`
+	TotalCost     Money `json:"totalCost"`
+	Depreciation  Money `json:"depreciation"`
+	ValueAtEnd    Money `json:"valueAtEnd"`
 }
 
 func SetupCalculatorRoutes(r *gin.Engine) {
@@ -89,22 +173,28 @@ func SetupCalculatorRoutes(r *gin.Engine) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Вариант финансирования не найден"})
 			return
 		}
+		if errs := validateFinanceRequest(financeOption, car.Price, req.DownPayment, req.TradeInValue, req.LoanTerm); len(errs) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Параметры не соответствуют условиям финансирования", "fields": errs})
+			return
+		}
+
 		loanAmount := car.Price - req.DownPayment - req.TradeInValue
 		monthlyInterestRate := financeOption.InterestRate / 100 / 12
 
-		var monthlyPayment float64
-		if monthlyInterestRate > 0 {
-			monthlyPayment = float64(loanAmount) * monthlyInterestRate *
-				(math.Pow(1+monthlyInterestRate, float64(req.LoanTerm))) /
-				(math.Pow(1+monthlyInterestRate, float64(req.LoanTerm)) - 1)
-		} else {
-			monthlyPayment = float64(loanAmount) / float64(req.LoanTerm)
+		var insuranceCost Money
+		if req.HasInsurance {
+			insuranceCost = car.Price.Mul(0.05).Div(12)
 		}
 
-		var insuranceCost float64 = 0
-		if req.HasInsurance {
-			insuranceCost = float64(car.Price) * 0.05 / 12
+		plan, err := buildFinancePlan(financeOption, car.Price, loanAmount, req.LoanTerm, insuranceCost)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
 		}
+		monthlyPayment := plan.MonthlyPayment
+		schedule := plan.Schedule
+		totalInterest := scheduleInterest(schedule)
+		excessMileage := excessMileageCost(financeOption, req.YearlyMileage, req.LoanTerm)
 
 		totalMonthlyPayment := monthlyPayment + insuranceCost
 		calculation := CostCalculation{
@@ -113,20 +203,52 @@ func SetupCalculatorRoutes(r *gin.Engine) {
 			FinanceOptionID: req.FinanceOptionID,
 			DownPayment:     req.DownPayment,
 			LoanTerm:        req.LoanTerm,
-			InsuranceCost:   int(insuranceCost * float64(req.LoanTerm)),
+			InsuranceCost:   insuranceCost.Times(req.LoanTerm),
 			TradeInValue:    req.TradeInValue,
-			CreatedAt:       time.Now(),
+			CreatedAt:       clockFrom(c).Now(),
+			CarPrice:        car.Price,
+			HasInsurance:    req.HasInsurance,
+			MonthlyPayment:  monthlyPayment,
+			Terms:           financeTermsOf(financeOption),
 		}
-		db.Create(&calculation)
-		c.JSON(http.StatusOK, MonthlyPaymentResponse{
+		if err := db.Create(&calculation).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при сохранении расчета"})
+			return
+		}
+		response := MonthlyPaymentResponse{
 			MonthlyLoanPayment:  monthlyPayment,
 			InsuranceCost:       insuranceCost,
 			TotalMonthlyPayment: totalMonthlyPayment,
-			TotalCost:           totalMonthlyPayment * float64(req.LoanTerm),
+			TotalCost:           totalMonthlyPayment.Times(req.LoanTerm) + plan.BalloonPayment + excessMileage,
 			CalculationID:       calculation.ID,
-		})
+			LoanAmount:          loanAmount,
+			TotalInterest:       totalInterest,
+			Overpayment:         totalInterest + insuranceCost.Times(req.LoanTerm),
+			EffectiveAnnualRate: effectiveAnnualRate(monthlyInterestRate),
+			ProductType:         financeOption.ProductType,
+			ResidualValue:       plan.ResidualValue,
+			BalloonPayment:      plan.BalloonPayment,
+			ExcessMileageCost:   excessMileage,
+		}
+		if req.Schedule {
+			response.Schedule = schedule
+		}
+		c.JSON(http.StatusOK, response)
 	})
 
+	// сохраненные расчеты
+	calculations := r.Group("/api/calculator/calculations")
+	calculations.Use(authMiddleware(), requirePermission(PermCalculationsRead))
+	{
+		calculations.GET("", listCostCalculations)
+		calculations.GET("/compare", compareCostCalculations)
+		calculations.GET("/:id", getCostCalculation)
+		calculations.POST("/:id/early-repayment", calculateSavedEarlyRepayment)
+	}
+
+	// досрочное погашение
+	r.POST("/api/calculator/early-repayment", calculateEarlyRepayment)
+
 	// общая стоимость владения
 	r.POST("/api/calculator/total-cost", func(c *gin.Context) {
 		var req TotalCostRequest
@@ -140,39 +262,78 @@ func SetupCalculatorRoutes(r *gin.Engine) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "База данных недоступна"})
 			return
 		}
-		if err := db.First(&car, req.CarID).Error; err != nil {
+		if err := db.Preload("Brand").Preload("Model").First(&car, req.CarID).Error; err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Автомобиль не найден"})
 			return
 		}
-		years := float64(req.LoanTerm) / 12
-		fuelConsumptionPer100km := 8.0
-		fuelCostPerLiter := 50.0
-		yearlyFuelCost := fuelConsumptionPer100km / 100 * float64(req.YearlyMileage) * fuelCostPerLiter
-
-		var yearlyServiceCost float64
-		if car.BrandID <= 5 {
-			yearlyServiceCost = float64(car.Price) * 0.05
-		} else {
-			yearlyServiceCost = float64(car.Price) * 0.03
+
+		profile := standardServiceProfile
+		if car.Brand.ServiceProfileID != nil {
+			db.First(&profile, *car.Brand.ServiceProfileID)
 		}
 
-		taxPerYear := float64(car.EnginePower) * 10
-		insurancePerYear := float64(car.Price) * 0.05
-		totalOwnershipCost := float64(car.Price) +
-			(yearlyFuelCost+yearlyServiceCost+taxPerYear+insurancePerYear)*years
-
-		c.JSON(http.StatusOK, TotalCostResponse{
-			InitialPrice:     int(car.Price),
-			FuelCost:         yearlyFuelCost * years,
-			ServiceCost:      yearlyServiceCost * years,
-			TaxCost:          taxPerYear * years,
-			InsuranceCost:    insurancePerYear * years,
-			TotalCost:        totalOwnershipCost,
-			YearsOfOwnership: years,
-		})
+		if req.Region == "" {
+			req.Region = defaultTaxRegion
+		}
+		var region TransportTaxRegion
+		if err := db.Where("code = ?", req.Region).First(&region).Error; err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Нет ставок транспортного налога для региона " + req.Region})
+			return
+		}
+
+		asOf, err := parseAsOf(req.AsOf, clockFrom(c))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "asOf: ожидается дата в формате " + tariffDateLayout})
+			return
+		}
+
+		result, err := calculateTotalCost(car, req, profile, region, asOf)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, result)
 	})
 }
 
+// аннуитетный платеж
+func annuityPayment(principal, monthlyRate float64, term int) float64 {
+	if monthlyRate > 0 {
+		return principal * monthlyRate * math.Pow(1+monthlyRate, float64(term)) /
+			(math.Pow(1+monthlyRate, float64(term)) - 1)
+	}
+	return principal / float64(term)
+}
+
+// график аннуитетных платежей: проценты округляются до копейки каждый месяц,
+// последний платеж закрывает остаток долга
+func buildPaymentSchedule(principal, payment Money, monthlyRate float64, term int, insurance Money) []PaymentScheduleItem {
+	schedule := make([]PaymentScheduleItem, 0, term)
+	balance := principal
+	for month := 1; month <= term; month++ {
+		interest := balance.Mul(monthlyRate)
+		principalPart := payment - interest
+		if month == term {
+			principalPart = balance
+		}
+		balance -= principalPart
+		schedule = append(schedule, PaymentScheduleItem{
+			Month:            month,
+			Payment:          principalPart + interest,
+			InterestPart:     interest,
+			PrincipalPart:    principalPart,
+			InsurancePayment: insurance,
+			RemainingBalance: balance,
+		})
+	}
+	return schedule
+}
+
+// эффективная годовая ставка в процентах
+func effectiveAnnualRate(monthlyRate float64) float64 {
+	return (math.Pow(1+monthlyRate, 12) - 1) * 100
+}
+
 // расчет стоимости импорта автомобиля
 func calculateImportCost(c *gin.Context) {
 	var calc ImportCalculation
@@ -180,99 +341,151 @@ func calculateImportCost(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	db, ok := c.MustGet("db").(*gorm.DB)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "База данных недоступна"})
+		return
+	}
+
+	date, err := parseAsOf(calc.Date, clockFrom(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date: ожидается дата в формате " + tariffDateLayout})
+		return
+	}
+	calc.Date = date.Format(tariffDateLayout)
+
+	tariff, err := findTariff(db, date)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Нет тарифа, действующего на " + calc.Date})
+		return
+	}
+	calc.TariffID = tariff.ID
+	calc.TariffName = tariff.Name
+
+	calc.Currency = strings.ToUpper(calc.Currency)
+	if calc.Currency == "" {
+		calc.Currency = baseCurrency
+	}
+	if !importCurrencies[calc.Currency] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неподдерживаемая валюта: " + calc.Currency})
+		return
+	}
+	rate, err := findExchangeRate(db, calc.Currency, date)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Нет курса " + calc.Currency + " на " + calc.Date})
+		return
+	}
+	calc.ExchangeRate = rate.Rate
+	calc.ExchangeRateDate = rate.Date.Format(tariffDateLayout)
+	calc.CarPriceRub = calc.CarPrice.Mul(rate.Rate)
+
+	calc.FuelType, err = normalizeFuelType(calc.FuelType)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	calc.CustomsFee = calculateCustomsFee(calc.CarPrice, calc.CarYear, calc.Country)
-	calc.ExciseTax = calculateExciseTax(calc.EngineVolume, calc.CarYear)
-	calc.VAT = calculateVAT(calc.CarPrice + calc.CustomsFee + calc.ExciseTax)
-	calc.UtilizationFee = calculateUtilizationFee(calc.CarYear)
-	calc.RegistrationFee = calculateRegistrationFee(calc.EnginePower)
-	calc.TotalCost = calc.CarPrice + calc.CustomsFee + calc.ExciseTax + calc.VAT +
+	rules := tariff.Rules
+	age := carAge(calc.CarYear, date)
+	if calc.FuelType == FuelElectric {
+		if rules.Electric == nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "В тарифе " + tariff.Name + " нет правил для электромобилей"})
+			return
+		}
+		if calc.ElectricPower <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Для электромобиля нужна мощность electricPower в кВт"})
+			return
+		}
+		calc.CustomsFee = calculateElectricCustomsFee(*rules.Electric, calc.CarPriceRub)
+		calc.ExciseTax = calculateElectricExciseTax(*rules.Electric, calc.ElectricPower)
+		calc.UtilizationFee = calculateElectricUtilizationFee(*rules.Electric, age)
+	} else {
+		calc.CustomsFee = calculateCustomsFee(rules, calc.CarPriceRub, age, calc.Country)
+		calc.ExciseTax = calculateExciseTax(rules, calc.EngineVolume, age)
+		calc.UtilizationFee = calculateUtilizationFee(rules, age)
+	}
+	calc.VAT = calculateVAT(rules, calc.CarPriceRub+calc.CustomsFee+calc.ExciseTax)
+
+	horsePower := calc.EnginePower
+	if horsePower == 0 && calc.ElectricPower > 0 {
+		horsePower = int(math.Round(float64(calc.ElectricPower) * kwToHP))
+	}
+	calc.RegistrationFee = calculateRegistrationFee(rules, horsePower)
+	calc.TotalCost = calc.CarPriceRub + calc.CustomsFee + calc.ExciseTax + calc.VAT +
 		calc.UtilizationFee + calc.RegistrationFee
+
+	calc.Lines = []ImportFeeLine{}
+	for _, line := range []struct {
+		name   string
+		amount Money
+	}{
+		{"carPrice", calc.CarPriceRub},
+		{"customsFee", calc.CustomsFee},
+		{"exciseTax", calc.ExciseTax},
+		{"vat", calc.VAT},
+		{"utilizationFee", calc.UtilizationFee},
+		{"registrationFee", calc.RegistrationFee},
+		{"totalCost", calc.TotalCost},
+	} {
+		calc.Lines = append(calc.Lines, ImportFeeLine{
+			Name:           line.name,
+			Amount:         line.amount,
+			OriginalAmount: line.amount.Quo(rate.Rate),
+		})
+	}
 	c.JSON(http.StatusOK, calc)
 }
 
 // расчет таможенной пошлины
-func calculateCustomsFee(carPrice float64, carYear int, country string) float64 {
-	age := time.Now().Year() - carYear
-	var rate float64
-	switch {
-	case country == "ЕС" && age <= 3:
-		rate = 0.15
-	case country == "ЕС" && age <= 5:
-		rate = 0.20
-	case country == "ЕС" && age <= 7:
-		rate = 0.25
-	case country == "ЕС":
-		rate = 0.30
-	case country == "США" && age <= 3:
-		rate = 0.18
-	case country == "США" && age <= 5:
-		rate = 0.23
-	case country == "США" && age <= 7:
-		rate = 0.28
-	case country == "США":
-		rate = 0.33
-	default:
-		rate = 0.25
+func calculateCustomsFee(rules TariffRules, carPrice Money, age int, country string) Money {
+	if alias, ok := rules.CountryAliases[country]; ok {
+		country = alias
+	}
+	var brackets []TariffBracket
+	for _, rule := range rules.Customs {
+		if rule.Country == country {
+			brackets = rule.Brackets
+			break
+		}
+		if rule.Country == "" {
+			brackets = rule.Brackets
+		}
 	}
-	return carPrice * rate
+	return carPrice.Mul(bracketValue(brackets, float64(age)))
 }
 
 // расчет акцизного сбора
-func calculateExciseTax(engineVolume float64, carYear int) float64 {
-	age := time.Now().Year() - carYear
-	var rate float64
-	switch {
-	case engineVolume <= 1.0:
-		rate = 3000
-	case engineVolume <= 1.5:
-		rate = 5000
-	case engineVolume <= 2.0:
-		rate = 7000
-	case engineVolume <= 3.0:
-		rate = 9000
-	default:
-		rate = 12000
-	}
-	ageCoefficient := 1.0
-	if age > 5 {
-		ageCoefficient = 1.5
-	}
-	if age > 10 {
-		ageCoefficient = 2.0
-	}
-
-	return rate * ageCoefficient
+func calculateExciseTax(rules TariffRules, engineVolume float64, age int) Money {
+	rate := moneyFromFloat(bracketValue(rules.ExciseByVolume, engineVolume))
+	return rate.Mul(bracketValue(rules.ExciseAgeCoefficient, float64(age)))
 }
 
 // расчет НДС
-func calculateVAT(baseSum float64) float64 {
-	return baseSum * 0.20
+func calculateVAT(rules TariffRules, baseSum Money) Money {
+	return baseSum.Mul(rules.VATRate)
 }
 
 // расчет утиля
-func calculateUtilizationFee(carYear int) float64 {
-	age := time.Now().Year() - carYear
-	if age <= 3 {
-		return 3000
-	} else if age <= 7 {
-		return 5000
-	}
-	return 8000
+func calculateUtilizationFee(rules TariffRules, age int) Money {
+	return moneyFromFloat(bracketValue(rules.UtilizationByAge, float64(age)))
+}
+
+// расчет пошлины для электромобиля
+func calculateElectricCustomsFee(rules ElectricRules, carPrice Money) Money {
+	return carPrice.Mul(rules.CustomsRate)
+}
+
+// расчет акциза для электромобиля: ставка за кВт по ступени мощности
+func calculateElectricExciseTax(rules ElectricRules, powerKW int) Money {
+	return moneyFromFloat(bracketValue(rules.ExciseByPower, float64(powerKW))).Times(powerKW)
+}
+
+// расчет утиля для электромобиля
+func calculateElectricUtilizationFee(rules ElectricRules, age int) Money {
+	return moneyFromFloat(bracketValue(rules.UtilizationByAge, float64(age)))
 }
 
 // расчет регистрационного сбора
-func calculateRegistrationFee(enginePower int) float64 {
-	switch {
-	case enginePower <= 100:
-		return 2000
-	case enginePower <= 150:
-		return 3000
-	case enginePower <= 200:
-		return 5000
-	case enginePower <= 250:
-		return 7500
-	default:
-		return 10000
-	}
+func calculateRegistrationFee(rules TariffRules, enginePower int) Money {
+	return moneyFromFloat(bracketValue(rules.RegistrationByPower, float64(enginePower)))
 }
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+const epsilon = 0.005
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < epsilon
+}
+
+func date(value string) time.Time {
+	parsed, err := time.Parse(tariffDateLayout, value)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func TestCalculateCustomsFee(t *testing.T) {
+	rules := defaultTariffRules()
+	tests := []struct {
+		country string
+		age     int
+		want    Money
+	}{
+		{"ЕС", 0, rub(150000)},
+		{"ЕС", 3, rub(150000)},
+		{"ЕС", 4, rub(200000)},
+		{"ЕС", 5, rub(200000)},
+		{"ЕС", 6, rub(250000)},
+		{"ЕС", 7, rub(250000)},
+		{"ЕС", 8, rub(300000)},
+		{"ЕС", 30, rub(300000)},
+		{"США", 0, rub(180000)},
+		{"США", 3, rub(180000)},
+		{"США", 4, rub(230000)},
+		{"США", 5, rub(230000)},
+		{"США", 6, rub(280000)},
+		{"США", 7, rub(280000)},
+		{"США", 8, rub(330000)},
+		{"EU", 3, rub(150000)},
+		{"EU", 4, rub(200000)},
+		{"USA", 8, rub(330000)},
+		{"US", 5, rub(230000)},
+		{"Япония", 0, rub(250000)},
+		{"Япония", 20, rub(250000)},
+		{"", 5, rub(250000)},
+	}
+	for _, tt := range tests {
+		got := calculateCustomsFee(rules, rub(1000000), tt.age, tt.country)
+		if got != tt.want {
+			t.Errorf("calculateCustomsFee(%q, age %d) = %v, want %v", tt.country, tt.age, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateExciseTax(t *testing.T) {
+	rules := defaultTariffRules()
+	tests := []struct {
+		volume float64
+		age    int
+		want   Money
+	}{
+		{0.8, 0, rub(3000)},
+		{1.0, 0, rub(3000)},
+		{1.01, 0, rub(5000)},
+		{1.5, 0, rub(5000)},
+		{1.51, 0, rub(7000)},
+		{2.0, 0, rub(7000)},
+		{2.01, 0, rub(9000)},
+		{3.0, 0, rub(9000)},
+		{3.01, 0, rub(12000)},
+		{6.2, 0, rub(12000)},
+		{1.0, 5, rub(3000)},
+		{1.0, 6, rub(4500)},
+		{1.0, 10, rub(4500)},
+		{1.0, 11, rub(6000)},
+		{3.01, 5, rub(12000)},
+		{3.01, 6, rub(18000)},
+		{3.01, 10, rub(18000)},
+		{3.01, 11, rub(24000)},
+	}
+	for _, tt := range tests {
+		got := calculateExciseTax(rules, tt.volume, tt.age)
+		if got != tt.want {
+			t.Errorf("calculateExciseTax(%v, age %d) = %v, want %v", tt.volume, tt.age, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateUtilizationFee(t *testing.T) {
+	rules := defaultTariffRules()
+	tests := []struct {
+		age  int
+		want Money
+	}{
+		{0, rub(3000)},
+		{3, rub(3000)},
+		{4, rub(5000)},
+		{7, rub(5000)},
+		{8, rub(8000)},
+		{25, rub(8000)},
+	}
+	for _, tt := range tests {
+		if got := calculateUtilizationFee(rules, tt.age); got != tt.want {
+			t.Errorf("calculateUtilizationFee(age %d) = %v, want %v", tt.age, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateRegistrationFee(t *testing.T) {
+	rules := defaultTariffRules()
+	tests := []struct {
+		power int
+		want  Money
+	}{
+		{0, rub(2000)},
+		{100, rub(2000)},
+		{101, rub(3000)},
+		{150, rub(3000)},
+		{151, rub(5000)},
+		{200, rub(5000)},
+		{201, rub(7500)},
+		{250, rub(7500)},
+		{251, rub(10000)},
+		{800, rub(10000)},
+	}
+	for _, tt := range tests {
+		if got := calculateRegistrationFee(rules, tt.power); got != tt.want {
+			t.Errorf("calculateRegistrationFee(%d) = %v, want %v", tt.power, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateElectricFees(t *testing.T) {
+	rules := *defaultTariffRules().Electric
+	excise := []struct {
+		power int
+		want  Money
+	}{
+		{50, rub(0)},
+		{66, rub(0)},
+		{67, rub(67 * 45)},
+		{110, rub(110 * 45)},
+		{111, rub(111 * 820)},
+		{147, rub(147 * 820)},
+		{148, rub(148 * 1300)},
+		{221, rub(221 * 1300)},
+		{222, rub(222 * 1400)},
+		{294, rub(294 * 1400)},
+		{295, rub(295 * 1500)},
+	}
+	for _, tt := range excise {
+		if got := calculateElectricExciseTax(rules, tt.power); got != tt.want {
+			t.Errorf("calculateElectricExciseTax(%d) = %v, want %v", tt.power, got, tt.want)
+		}
+	}
+
+	utilization := []struct {
+		age  int
+		want Money
+	}{
+		{0, rub(3400)},
+		{3, rub(3400)},
+		{4, rub(5200)},
+	}
+	for _, tt := range utilization {
+		if got := calculateElectricUtilizationFee(rules, tt.age); got != tt.want {
+			t.Errorf("calculateElectricUtilizationFee(age %d) = %v, want %v", tt.age, got, tt.want)
+		}
+	}
+
+	if got := calculateElectricCustomsFee(rules, rub(1000000)); got != rub(150000) {
+		t.Errorf("calculateElectricCustomsFee = %v, want 150000", got)
+	}
+}
+
+func TestAnnuityPayment(t *testing.T) {
+	tests := []struct {
+		name        string
+		principal   float64
+		annualRate  float64
+		term        int
+		wantPayment float64
+	}{
+		{"12% на год", 1000000, 12, 12, 88848.79},
+		{"12% на один месяц", 1000000, 12, 1, 1010000},
+		{"10% на 5 лет", 2000000, 10, 60, 42494.09},
+		{"без процентов", 1200000, 0, 12, 100000},
+		{"без процентов на один месяц", 500000, 0, 1, 500000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monthlyRate := tt.annualRate / 100 / 12
+			got := annuityPayment(tt.principal, monthlyRate, tt.term)
+			if !almostEqual(got, tt.wantPayment) {
+				t.Fatalf("annuityPayment = %v, want %v", got, tt.wantPayment)
+			}
+
+			// график в копейках погашает весь долг
+			principal := moneyFromFloat(tt.principal)
+			schedule := buildPaymentSchedule(principal, moneyFromFloat(got), monthlyRate, tt.term, 0)
+			if len(schedule) != tt.term {
+				t.Fatalf("len(schedule) = %d, want %d", len(schedule), tt.term)
+			}
+			var principalPaid Money
+			for _, item := range schedule {
+				principalPaid += item.PrincipalPart
+				if item.Payment != item.PrincipalPart+item.InterestPart {
+					t.Errorf("month %d: payment %v != principal %v + interest %v", item.Month, item.Payment, item.PrincipalPart, item.InterestPart)
+				}
+			}
+			if principalPaid != principal {
+				t.Errorf("principal paid = %v, want %v", principalPaid, principal)
+			}
+			if last := schedule[len(schedule)-1]; last.RemainingBalance != 0 {
+				t.Errorf("remaining balance = %v, want 0", last.RemainingBalance)
+			}
+		})
+	}
+}
+
+func TestCarAgeAcrossNewYear(t *testing.T) {
+	rules := defaultTariffRules()
+	tests := []struct {
+		asOf    string
+		carYear int
+		wantAge int
+		wantFee Money
+	}{
+		{"2024-12-31", 2021, 3, rub(3000)},
+		{"2025-01-01", 2021, 4, rub(5000)},
+		{"2025-06-15", 2026, 0, rub(3000)},
+	}
+	for _, tt := range tests {
+		age := carAge(tt.carYear, date(tt.asOf))
+		if age != tt.wantAge {
+			t.Errorf("carAge(%d, %s) = %d, want %d", tt.carYear, tt.asOf, age, tt.wantAge)
+		}
+		if fee := calculateUtilizationFee(rules, age); fee != tt.wantFee {
+			t.Errorf("utilization fee on %s = %v, want %v", tt.asOf, fee, tt.wantFee)
+		}
+	}
+}
+
+func TestParseAsOf(t *testing.T) {
+	clock := fixedClock(time.Date(2025, 3, 14, 23, 59, 0, 0, time.UTC))
+
+	got, err := parseAsOf("", clock)
+	if err != nil || !got.Equal(date("2025-03-14")) {
+		t.Errorf("parseAsOf(\"\") = %v, %v, want 2025-03-14", got, err)
+	}
+	got, err = parseAsOf("2020-01-01", clock)
+	if err != nil || !got.Equal(date("2020-01-01")) {
+		t.Errorf("parseAsOf(2020-01-01) = %v, %v", got, err)
+	}
+	if _, err := parseAsOf("01.01.2020", clock); err == nil {
+		t.Error("parseAsOf(01.01.2020) returned no error")
+	}
+}
+
+func TestCalculateTotalCost(t *testing.T) {
+	car := Car{Year: 2023, Price: rub(1000000), EnginePower: 150}
+	req := TotalCostRequest{LoanTerm: 18, YearlyMileage: 10000}
+
+	result, err := calculateTotalCost(car, req, standardServiceProfile, defaultTransportTaxRegion(), date("2024-05-01"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Years) != 2 || result.Years[1].Months != 6 {
+		t.Fatalf("years = %+v, want 12 and 6 months", result.Years)
+	}
+
+	// год 1: возраст 1, год 2: возраст 2 и половина года
+	checks := []struct {
+		name      string
+		got, want Money
+	}{
+		{"fuelCost", result.FuelCost, rub(60000)},
+		{"serviceCost", result.ServiceCost, rub(45000)},
+		{"taxCost", result.TaxCost, rub(7875)},
+		{"insuranceCost", result.InsuranceCost, rub(75000)},
+		{"year 1 depreciation", result.Years[0].Depreciation, rub(150000)},
+		{"year 2 depreciation", result.Years[1].Depreciation, rub(42500)},
+		{"resaleValue", result.ResaleValue, rub(807500)},
+		{"netCost", result.NetCost, rub(1000000 + 60000 + 45000 + 7875 + 75000 - 807500)},
+	}
+	for _, check := range checks {
+		if check.got != check.want {
+			t.Errorf("%s = %v, want %v", check.name, check.got, check.want)
+		}
+	}
+}
+
+func TestMoneyRounding(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Money
+		want string
+	}{
+		{"половина копейки к четному вниз", moneyFromFloat(0.125), "0.12"},
+		{"половина копейки к четному вверх", moneyFromFloat(0.135), "0.14"},
+		{"больше половины", moneyFromFloat(0.1251), "0.13"},
+		{"отрицательная половина", moneyFromFloat(-0.125), "-0.12"},
+		{"без накопления ошибки", moneyFromFloat(0.1 + 0.2), "0.30"},
+		{"умножение", rub(1000).Mul(0.0125), "12.50"},
+		{"умножение с половиной копейки", Money(1).Mul(0.5), "0.00"},
+		{"деление", rub(100).Div(3), "33.33"},
+		{"деление с половиной копейки", Money(5).Div(2), "0.02"},
+		{"деление на курс", rub(100).Quo(92.5), "1.08"},
+	}
+	for _, tt := range tests {
+		if tt.got.String() != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(struct {
+		Price Money `json:"price"`
+	}{rub(2750000) + 5})
+	if err != nil || string(data) != `{"price":"2750000.05"}` {
+		t.Errorf("Marshal = %s, %v", data, err)
+	}
+
+	for _, input := range []string{`"1234.50"`, `1234.5`, `"1234.5"`} {
+		var m Money
+		if err := json.Unmarshal([]byte(input), &m); err != nil || m != Money(123450) {
+			t.Errorf("Unmarshal(%s) = %v, %v", input, m, err)
+		}
+	}
+	var m Money
+	if err := json.Unmarshal([]byte(`"12,50"`), &m); err == nil {
+		t.Error("Unmarshal(\"12,50\") returned no error")
+	}
+}
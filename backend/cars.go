@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultCarsLimit = 20
+	maxCarsLimit     = 100
+)
+
+// параметры поиска автомобилей
+type CarFilter struct {
+	BrandID      uint   `form:"brandId"`
+	ModelID      uint   `form:"modelId"`
+	ShopID       uint   `form:"shopId"`
+	YearFrom     int    `form:"yearFrom"`
+	YearTo       int    `form:"yearTo"`
+	PriceFrom    int    `form:"priceFrom"`
+	PriceTo      int    `form:"priceTo"`
+	MileageTo    *int   `form:"mileageTo"`
+	PowerFrom    int    `form:"powerFrom"`
+	PowerTo      int    `form:"powerTo"`
+	Transmission string `form:"transmission"`
+	Condition    string `form:"condition"`
+	Color        string `form:"color"`
+	Sort         string `form:"sort"`
+	Page         int    `form:"page"`
+	Limit        int    `form:"limit"`
+	Cursor       string `form:"cursor"`
+}
+
+// ответ со списком автомобилей
+type CarListResponse struct {
+	Items      []Car  `json:"items"`
+	Total      int64  `json:"total"`
+	Page       int    `json:"page,omitempty"`
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// ключ сортировки
+type carSortKey struct {
+	column string
+	value  func(car Car) interface{}
+	parse  func(raw json.RawMessage) (interface{}, error)
+}
+
+// курсор для постраничной выдачи
+type carCursor struct {
+	Value json.RawMessage `json:"v"`
+	ID    uint            `json:"id"`
+}
+
+func parseIntCursor(raw json.RawMessage) (interface{}, error) {
+	var v int64
+	err := json.Unmarshal(raw, &v)
+	return v, err
+}
+
+func parseMoneyCursor(raw json.RawMessage) (interface{}, error) {
+	var v Money
+	err := json.Unmarshal(raw, &v)
+	return v, err
+}
+
+func parseTimeCursor(raw json.RawMessage) (interface{}, error) {
+	var v time.Time
+	err := json.Unmarshal(raw, &v)
+	return v, err
+}
+
+var carSortKeys = map[string]carSortKey{
+	"price":       {"price", func(car Car) interface{} { return car.Price }, parseMoneyCursor},
+	"year":        {"year", func(car Car) interface{} { return car.Year }, parseIntCursor},
+	"mileage":     {"mileage", func(car Car) interface{} { return car.Mileage }, parseIntCursor},
+	"enginePower": {"engine_power", func(car Car) interface{} { return car.EnginePower }, parseIntCursor},
+	"arrivalDate": {"arrival_date", func(car Car) interface{} { return car.ArrivalDate }, parseTimeCursor},
+	"id":          {"id", func(car Car) interface{} { return car.ID }, parseIntCursor},
+}
+
+// готовые подборки поверх общего поиска
+var carPresets = map[string]func(f *CarFilter){
+	"new": func(f *CarFilter) {
+		f.Condition = "new"
+	},
+	"low-mileage": func(f *CarFilter) {
+		f.Condition = "used"
+		if f.MileageTo == nil || *f.MileageTo > 29999 {
+			limit := 29999
+			f.MileageTo = &limit
+		}
+	},
+}
+
+func SetupCarRoutes(r *gin.Engine, db *gorm.DB) {
+
+	// список автомобилей с фильтрами, сортировкой и пагинацией
+	r.GET("/api/cars", func(c *gin.Context) {
+		listCars(c, db, nil)
+	})
+
+	// новые автомобили
+	r.GET("/api/cars/new", func(c *gin.Context) {
+		listCars(c, db, carPresets["new"])
+	})
+
+	// автомобили с низким пробегом
+	r.GET("/api/cars/low-mileage", func(c *gin.Context) {
+		listCars(c, db, carPresets["low-mileage"])
+	})
+}
+
+func listCars(c *gin.Context, db *gorm.DB, preset func(f *CarFilter)) {
+	var filter CarFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if preset != nil {
+		preset(&filter)
+	}
+
+	result, err := searchCars(db, filter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// применение фильтров к запросу
+func applyCarFilter(query *gorm.DB, f CarFilter) *gorm.DB {
+	query = query.Where("in_stock = ?", true)
+	if f.BrandID > 0 {
+		query = query.Where("brand_id = ?", f.BrandID)
+	}
+	if f.ModelID > 0 {
+		query = query.Where("model_id = ?", f.ModelID)
+	}
+	if f.ShopID > 0 {
+		query = query.Where("shop_id = ?", f.ShopID)
+	}
+	if f.YearFrom > 0 {
+		query = query.Where("year >= ?", f.YearFrom)
+	}
+	if f.YearTo > 0 {
+		query = query.Where("year <= ?", f.YearTo)
+	}
+	if f.PriceFrom > 0 {
+		query = query.Where("price >= ?", f.PriceFrom)
+	}
+	if f.PriceTo > 0 {
+		query = query.Where("price <= ?", f.PriceTo)
+	}
+	if f.MileageTo != nil {
+		query = query.Where("mileage <= ?", *f.MileageTo)
+	}
+	if f.PowerFrom > 0 {
+		query = query.Where("engine_power >= ?", f.PowerFrom)
+	}
+	if f.PowerTo > 0 {
+		query = query.Where("engine_power <= ?", f.PowerTo)
+	}
+	if f.Transmission != "" {
+		query = query.Where("transmission = ?", f.Transmission)
+	}
+	if f.Condition != "" {
+		query = query.Where("condition = ?", f.Condition)
+	}
+	if f.Color != "" {
+		query = query.Where("LOWER(color) = ?", strings.ToLower(f.Color))
+	}
+	return query
+}
+
+// поиск автомобилей
+func searchCars(db *gorm.DB, f CarFilter) (CarListResponse, error) {
+	response := CarListResponse{Items: []Car{}}
+
+	sortName := strings.TrimPrefix(f.Sort, "-")
+	if sortName == "" {
+		sortName = "id"
+	}
+	key, ok := carSortKeys[sortName]
+	if !ok {
+		return response, fmt.Errorf("неизвестный ключ сортировки: %s", f.Sort)
+	}
+	desc := strings.HasPrefix(f.Sort, "-")
+
+	if f.Limit <= 0 {
+		f.Limit = defaultCarsLimit
+	}
+	if f.Limit > maxCarsLimit {
+		f.Limit = maxCarsLimit
+	}
+	response.Limit = f.Limit
+
+	if err := applyCarFilter(db.Model(&Car{}), f).Count(&response.Total).Error; err != nil {
+		return response, err
+	}
+
+	direction, cmp := "ASC", ">"
+	if desc {
+		direction, cmp = "DESC", "<"
+	}
+
+	query := applyCarFilter(db.Preload("Shop").Preload("Brand").Preload("Model"), f)
+	if key.column == "id" {
+		query = query.Order("id " + direction)
+	} else {
+		query = query.Order(key.column + " " + direction).Order("id " + direction)
+	}
+
+	if f.Cursor != "" {
+		cursor, value, err := decodeCarCursor(f.Cursor, key)
+		if err != nil {
+			return response, err
+		}
+		if key.column == "id" {
+			query = query.Where("id "+cmp+" ?", cursor.ID)
+		} else {
+			query = query.Where(fmt.Sprintf("(%s %s ?) OR (%s = ? AND id %s ?)", key.column, cmp, key.column, cmp),
+				value, value, cursor.ID)
+		}
+	} else {
+		if f.Page <= 0 {
+			f.Page = 1
+		}
+		response.Page = f.Page
+		query = query.Offset((f.Page - 1) * f.Limit)
+	}
+
+	if err := query.Limit(f.Limit).Find(&response.Items).Error; err != nil {
+		return response, err
+	}
+
+	if len(response.Items) == f.Limit {
+		last := response.Items[len(response.Items)-1]
+		next, err := encodeCarCursor(last, key)
+		if err != nil {
+			return response, err
+		}
+		response.NextCursor = next
+	}
+	return response, nil
+}
+
+func encodeCarCursor(car Car, key carSortKey) (string, error) {
+	value, err := json.Marshal(key.value(car))
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(carCursor{Value: value, ID: car.ID})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCarCursor(s string, key carSortKey) (carCursor, interface{}, error) {
+	var cursor carCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, nil, fmt.Errorf("некорректный курсор")
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, nil, fmt.Errorf("некорректный курсор")
+	}
+	value, err := key.parse(cursor.Value)
+	if err != nil {
+		return cursor, nil, fmt.Errorf("курсор не соответствует ключу сортировки")
+	}
+	return cursor, value, nil
+}
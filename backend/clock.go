@@ -0,0 +1,53 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// источник текущего времени для калькуляторов
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// часы с фиксированным временем для тестов и воспроизводимых расчетов
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+// часы из контекста запроса, по умолчанию системные
+func clockFrom(c *gin.Context) Clock {
+	if value, ok := c.Get("clock"); ok {
+		if clock, ok := value.(Clock); ok {
+			return clock
+		}
+	}
+	return systemClock{}
+}
+
+// дата расчета: из запроса в формате 2006-01-02 или текущая дата по часам
+func parseAsOf(value string, clock Clock) (time.Time, error) {
+	if value == "" {
+		now := clock.Now()
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+	return time.Parse(tariffDateLayout, value)
+}
+
+// возраст автомобиля в полных календарных годах на дату расчета
+func carAge(carYear int, asOf time.Time) int {
+	age := asOf.Year() - carYear
+	if age < 0 {
+		return 0
+	}
+	return age
+}
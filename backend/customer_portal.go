@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// предпочтения покупателя, которые он может менять сам
+type CustomerPreferences struct {
+	PreferredBrand string `json:"preferredBrand"`
+	YearFrom       int    `json:"yearFrom"`
+	YearTo         int    `json:"yearTo"`
+	MaxPrice       Money  `json:"maxPrice"`
+}
+
+// изменение предпочтений, незаданные поля не меняются
+type CustomerPreferencesRequest struct {
+	PreferredBrand *string `json:"preferredBrand"`
+	YearFrom       *int    `json:"yearFrom"`
+	YearTo         *int    `json:"yearTo"`
+	MaxPrice       *Money  `json:"maxPrice"`
+}
+
+var errEmailNotVerified = errors.New("Подтвердите email, чтобы получить доступ к данным покупателя")
+
+func preferencesOf(customer Customer) CustomerPreferences {
+	return CustomerPreferences{
+		PreferredBrand: customer.PreferredBrand,
+		YearFrom:       customer.YearFrom,
+		YearTo:         customer.YearTo,
+		MaxPrice:       customer.MaxPrice,
+	}
+}
+
+// привязка пользователя к карточке клиента с тем же email; к уже существующей
+// карточке, которую завел автосалон, привязываем только после подтверждения email,
+// иначе чужую историю покупок можно было бы открыть, зарегистрировавшись на чужой адрес
+func linkCustomer(db *gorm.DB, user *User) error {
+	if user.CustomerID != nil || userRole(*user) != RoleCustomer {
+		return nil
+	}
+
+	var customer Customer
+	linked := db.Model(&User{}).Select("customer_id").Where("customer_id IS NOT NULL")
+	err := db.Where("LOWER(email) = ? AND id NOT IN (?)", strings.ToLower(strings.TrimSpace(user.Email)), linked).
+		Order("id").First(&customer).Error
+	switch {
+	case err == nil:
+		if !user.EmailVerified {
+			return errEmailNotVerified
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		customer = Customer{FullName: user.FullName, Email: user.Email}
+		if err := db.Create(&customer).Error; err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	user.CustomerID = &customer.ID
+	return db.Model(user).Update("customer_id", customer.ID).Error
+}
+
+func validatePreferences(db *gorm.DB, prefs CustomerPreferences) []FieldError {
+	var errs []FieldError
+	if prefs.PreferredBrand != "" {
+		var count int64
+		db.Model(&CarBrand{}).Where("name = ?", prefs.PreferredBrand).Count(&count)
+		if count == 0 {
+			errs = append(errs, FieldError{Field: "preferredBrand", Rule: "exists", Message: "Бренд не найден"})
+		}
+	}
+	maxYear := time.Now().Year() + 1
+	for _, year := range []struct {
+		field string
+		value int
+	}{{"yearFrom", prefs.YearFrom}, {"yearTo", prefs.YearTo}} {
+		if year.value != 0 && (year.value < 1900 || year.value > maxYear) {
+			errs = append(errs, FieldError{
+				Field:   year.field,
+				Rule:    "yearRange",
+				Message: "Год должен быть от 1900 до следующего за текущим",
+				Min:     floatPtr(1900),
+				Max:     floatPtr(float64(maxYear)),
+			})
+		}
+	}
+	if prefs.YearFrom != 0 && prefs.YearTo != 0 && prefs.YearFrom > prefs.YearTo {
+		errs = append(errs, FieldError{
+			Field:   "yearTo",
+			Rule:    "yearOrder",
+			Message: "Год до не может быть меньше года от",
+			Min:     floatPtr(float64(prefs.YearFrom)),
+		})
+	}
+	if prefs.MaxPrice < 0 {
+		errs = append(errs, FieldError{
+			Field:   "maxPrice",
+			Rule:    "nonNegative",
+			Message: "Бюджет не может быть отрицательным",
+			Min:     floatPtr(0),
+		})
+	}
+	return errs
+}
+
+// карточка клиента текущего пользователя; при ошибке ответ уже записан
+func portalCustomer(c *gin.Context, db *gorm.DB) (Customer, bool) {
+	var customer Customer
+	user, ok := currentUser(c, db)
+	if !ok {
+		return customer, false
+	}
+	if userRole(user) != RoleCustomer {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Личный кабинет доступен только покупателям"})
+		return customer, false
+	}
+	if err := linkCustomer(db, &user); err != nil {
+		if errors.Is(err, errEmailNotVerified) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "emailVerificationRequired": true})
+			return customer, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка привязки к карточке клиента"})
+		return customer, false
+	}
+	if err := db.First(&customer, *user.CustomerID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Клиент не найден"})
+		return customer, false
+	}
+	return customer, true
+}
+
+func SetupCustomerPortalRoutes(userRoutes *gin.RouterGroup, db *gorm.DB) {
+
+	// карточка клиента текущего пользователя
+	userRoutes.GET("/profile", func(c *gin.Context) {
+		customer, ok := portalCustomer(c, db)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, customer)
+	})
+
+	userRoutes.GET("/preferences", func(c *gin.Context) {
+		customer, ok := portalCustomer(c, db)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, preferencesOf(customer))
+	})
+
+	userRoutes.PUT("/preferences", func(c *gin.Context) {
+		var req CustomerPreferencesRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		customer, ok := portalCustomer(c, db)
+		if !ok {
+			return
+		}
+
+		prefs := preferencesOf(customer)
+		if req.PreferredBrand != nil {
+			prefs.PreferredBrand = strings.TrimSpace(*req.PreferredBrand)
+		}
+		if req.YearFrom != nil {
+			prefs.YearFrom = *req.YearFrom
+		}
+		if req.YearTo != nil {
+			prefs.YearTo = *req.YearTo
+		}
+		if req.MaxPrice != nil {
+			prefs.MaxPrice = *req.MaxPrice
+		}
+		if errs := validatePreferences(db, prefs); len(errs) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Некорректные предпочтения", "fields": errs})
+			return
+		}
+
+		err := db.Model(&customer).Updates(map[string]interface{}{
+			"preferred_brand": prefs.PreferredBrand,
+			"year_from":       prefs.YearFrom,
+			"year_to":         prefs.YearTo,
+			"max_price":       prefs.MaxPrice,
+		}).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при сохранении предпочтений"})
+			return
+		}
+		c.JSON(http.StatusOK, prefs)
+	})
+
+	// сохраненные расчеты покупателя
+	userRoutes.GET("/calculations", func(c *gin.Context) {
+		customer, ok := portalCustomer(c, db)
+		if !ok {
+			return
+		}
+		var calculations []CostCalculation
+		costCalculationsQuery(db).Where("customer_id = ?", customer.ID).Order("created_at DESC").Find(&calculations)
+
+		// свои контакты покупатель видит полностью
+		result := make([]CostCalculationView, 0, len(calculations))
+		for _, calc := range calculations {
+			result = append(result, buildCostCalculationView(calc, true))
+		}
+		c.JSON(http.StatusOK, result)
+	})
+
+	// покупки, включая отмененные
+	userRoutes.GET("/sales", func(c *gin.Context) {
+		customer, ok := portalCustomer(c, db)
+		if !ok {
+			return
+		}
+		var sales []Sale
+		salesQuery(db).Where("customer_id = ?", customer.ID).Order("sale_date DESC").Find(&sales)
+		c.JSON(http.StatusOK, saleViews(c, sales))
+	})
+}
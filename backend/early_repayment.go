@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// стратегии досрочного погашения
+const (
+	EarlyRepaymentReduceTerm    = "term"
+	EarlyRepaymentReducePayment = "payment"
+)
+
+// досрочный платеж, сумма 0 означает полное погашение
+type EarlyRepayment struct {
+	Month  int   `json:"month" binding:"min=1"`
+	Amount Money `json:"amount" binding:"min=0"`
+}
+
+// расчет досрочного погашения по параметрам кредита;
+// для сохраненного расчета параметры кредита берутся из него
+type EarlyRepaymentRequest struct {
+	// сохраненный расчет указывается в пути, в теле запроса отклоняется
+	CalculationID   uint             `json:"calculationId"`
+	CarID           uint             `json:"carId"`
+	FinanceOptionID uint             `json:"financeOptionId"`
+	DownPayment     Money            `json:"downPayment"`
+	LoanTerm        int              `json:"loanTerm"`
+	TradeInValue    Money            `json:"tradeInValue"`
+	Strategy        string           `json:"strategy" binding:"required,oneof=term payment"`
+	Repayments      []EarlyRepayment `json:"repayments" binding:"required,min=1,dive"`
+}
+
+type EarlyRepaymentResponse struct {
+	LoanAmount            Money                 `json:"loanAmount"`
+	OriginalPayment       Money                 `json:"originalPayment"`
+	OriginalTerm          int                   `json:"originalTerm"`
+	OriginalTotalInterest Money                 `json:"originalTotalInterest"`
+	NewTerm               int                   `json:"newTerm"`
+	LastPayment           Money                 `json:"lastPayment"`
+	TotalInterest         Money                 `json:"totalInterest"`
+	InterestSaved         Money                 `json:"interestSaved"`
+	Schedule              []PaymentScheduleItem `json:"schedule"`
+}
+
+var errPaymentBelowInterest = errors.New("Платеж не покрывает проценты, долг не погашается")
+
+// сумма процентов по графику
+func scheduleInterest(schedule []PaymentScheduleItem) Money {
+	var total Money
+	for _, item := range schedule {
+		total += item.InterestPart
+	}
+	return total
+}
+
+// график с досрочными погашениями: после каждого досрочного платежа
+// либо сокращается срок при прежнем платеже, либо пересчитывается платеж на оставшийся срок;
+// график не длиннее исходного срока, последний платеж закрывает остаток долга
+func buildEarlyRepaymentSchedule(principal, payment Money, monthlyRate float64, term int, repayments map[int]Money, strategy string) ([]PaymentScheduleItem, error) {
+	balance := principal
+	var schedule []PaymentScheduleItem
+
+	for month := 1; month <= term && balance > 0; month++ {
+		interest := balance.Mul(monthlyRate)
+		principalPart := payment - interest
+		if principalPart >= balance || month == term {
+			principalPart = balance
+		} else if principalPart <= 0 {
+			return nil, errPaymentBelowInterest
+		}
+		balance -= principalPart
+
+		item := PaymentScheduleItem{
+			Month:         month,
+			Payment:       principalPart + interest,
+			InterestPart:  interest,
+			PrincipalPart: principalPart,
+		}
+
+		if amount, ok := repayments[month]; ok && balance > 0 {
+			if amount <= 0 || amount > balance {
+				amount = balance
+			}
+			balance -= amount
+			item.EarlyRepayment = amount
+			if strategy == EarlyRepaymentReducePayment && balance > 0 {
+				payment = moneyFromFloat(annuityPayment(balance.Float(), monthlyRate, term-month))
+			}
+		}
+
+		item.RemainingBalance = balance
+		schedule = append(schedule, item)
+	}
+	return schedule, nil
+}
+
+// расчет досрочного погашения по параметрам кредита
+func calculateEarlyRepayment(c *gin.Context) {
+	var req EarlyRepaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	db, ok := c.MustGet("db").(*gorm.DB)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "База данных недоступна"})
+		return
+	}
+
+	// сохраненные расчеты доступны только сотрудникам с правом на них
+	if req.CalculationID > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Для сохраненного расчета используйте /api/calculator/calculations/:id/early-repayment"})
+		return
+	}
+
+	var car Car
+	var financeOption FinanceOption
+	if err := db.First(&car, req.CarID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Автомобиль не найден"})
+		return
+	}
+	if err := db.First(&financeOption, req.FinanceOptionID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Вариант финансирования не найден"})
+		return
+	}
+	respondEarlyRepayment(c, req, car.Price, financeOption)
+}
+
+// расчет досрочного погашения по сохраненному расчету: цена автомобиля и условия
+// берутся из снимка на момент расчета, чтобы воспроизвести прежний график
+func calculateSavedEarlyRepayment(c *gin.Context) {
+	var req EarlyRepaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	db, ok := c.MustGet("db").(*gorm.DB)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "База данных недоступна"})
+		return
+	}
+
+	var calculation CostCalculation
+	query := db.Preload("Car", withDeleted).Preload("FinanceOption")
+	if err := scopeCalculationsToShop(c, db, query).First(&calculation, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Расчет не найден"})
+		return
+	}
+	if calculation.Car.ID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Автомобиль не найден"})
+		return
+	}
+	if calculation.FinanceOption.ID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Вариант финансирования не найден"})
+		return
+	}
+	req.DownPayment = calculation.DownPayment
+	req.LoanTerm = calculation.LoanTerm
+	req.TradeInValue = calculation.TradeInValue
+
+	// для старых расчетов снимка нет, используются текущие цена и условия
+	carPrice, financeOption := calculation.Car.Price, calculation.FinanceOption
+	if calculation.Terms.ProductType != "" {
+		carPrice = calculation.CarPrice
+		financeOption = calculation.Terms.apply(financeOption)
+	}
+	respondEarlyRepayment(c, req, carPrice, financeOption)
+}
+
+// график досрочного погашения для цены автомобиля и условий финансирования
+func respondEarlyRepayment(c *gin.Context, req EarlyRepaymentRequest, carPrice Money, financeOption FinanceOption) {
+	if financeOption.ProductType != FinanceProductLoan {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Досрочное погашение рассчитывается только для кредита"})
+		return
+	}
+
+	if errs := validateFinanceRequest(financeOption, carPrice, req.DownPayment, req.TradeInValue, req.LoanTerm); len(errs) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Параметры не соответствуют условиям финансирования", "fields": errs})
+		return
+	}
+
+	loanAmount := carPrice - req.DownPayment - req.TradeInValue
+
+	repayments := make(map[int]Money, len(req.Repayments))
+	for _, repayment := range req.Repayments {
+		if repayment.Month > req.LoanTerm {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Месяц досрочного погашения превышает срок кредита"})
+			return
+		}
+		repayments[repayment.Month] += repayment.Amount
+	}
+
+	monthlyRate := financeOption.InterestRate / 100 / 12
+	payment, err := roundPayment(annuityPayment(loanAmount.Float(), monthlyRate, req.LoanTerm))
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	original := buildPaymentSchedule(loanAmount, payment, monthlyRate, req.LoanTerm, 0)
+	schedule, err := buildEarlyRepaymentSchedule(loanAmount, payment, monthlyRate, req.LoanTerm, repayments, req.Strategy)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	originalInterest := scheduleInterest(original)
+	totalInterest := scheduleInterest(schedule)
+	c.JSON(http.StatusOK, EarlyRepaymentResponse{
+		LoanAmount:            loanAmount,
+		OriginalPayment:       original[0].Payment,
+		OriginalTerm:          req.LoanTerm,
+		OriginalTotalInterest: originalInterest,
+		NewTerm:               len(schedule),
+		LastPayment:           schedule[len(schedule)-1].Payment,
+		TotalInterest:         totalInterest,
+		InterestSaved:         originalInterest - totalInterest,
+		Schedule:              schedule,
+	})
+}
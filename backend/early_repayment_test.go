@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEarlyRepaymentSchedule(t *testing.T) {
+	principal := rub(1000000)
+	monthlyRate := 12.0 / 100 / 12
+	payment := moneyFromFloat(annuityPayment(principal.Float(), monthlyRate, 12))
+	repayments := map[int]Money{3: rub(300000)}
+
+	for _, tt := range []struct {
+		strategy string
+		shorter  bool
+	}{
+		{EarlyRepaymentReduceTerm, true},
+		{EarlyRepaymentReducePayment, false},
+	} {
+		t.Run(tt.strategy, func(t *testing.T) {
+			schedule, err := buildEarlyRepaymentSchedule(principal, payment, monthlyRate, 12, repayments, tt.strategy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(schedule) > 12 || (len(schedule) < 12) != tt.shorter {
+				t.Fatalf("len(schedule) = %d", len(schedule))
+			}
+			var paid Money
+			for _, item := range schedule {
+				paid += item.PrincipalPart + item.EarlyRepayment
+			}
+			if paid != principal {
+				t.Errorf("principal paid = %v, want %v", paid, principal)
+			}
+			if last := schedule[len(schedule)-1]; last.RemainingBalance != 0 {
+				t.Errorf("remaining balance = %v, want 0", last.RemainingBalance)
+			}
+		})
+	}
+}
+
+// платеж в копейку при процентах в копейку не уменьшал долг, и график рос бесконечно
+func TestEarlyRepaymentPaymentBelowInterest(t *testing.T) {
+	principal := Money(60)
+	monthlyRate := 15.0 / 100 / 12
+	payment, err := roundPayment(annuityPayment(principal.Float(), monthlyRate, 84))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = buildEarlyRepaymentSchedule(principal, payment, monthlyRate, 84, map[int]Money{84: Money(10)}, EarlyRepaymentReduceTerm)
+	if !errors.Is(err, errPaymentBelowInterest) {
+		t.Fatalf("err = %v, want %v", err, errPaymentBelowInterest)
+	}
+
+	if _, err := roundPayment(annuityPayment(Money(30).Float(), 0, 84)); err == nil {
+		t.Fatal("zero payment accepted")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+const baseCurrency = "RUB"
+
+// валюты цены покупки при импорте
+var importCurrencies = map[string]bool{
+	"RUB": true,
+	"EUR": true,
+	"USD": true,
+	"JPY": true,
+	"KRW": true,
+	"CNY": true,
+}
+
+// Модель курса валюты: сколько рублей стоит одна единица валюты на дату
+type ExchangeRate struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Currency  string    `json:"currency" gorm:"uniqueIndex:idx_exchange_rates_currency_date"`
+	Date      time.Time `json:"date" gorm:"uniqueIndex:idx_exchange_rates_currency_date"`
+	Rate      float64   `json:"rate"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// курс в запросах и файлах импорта, дата в формате 2006-01-02
+type ExchangeRateInput struct {
+	Currency string  `json:"currency" yaml:"currency" binding:"required"`
+	Date     string  `json:"date" yaml:"date" binding:"required"`
+	Rate     float64 `json:"rate" yaml:"rate" binding:"required"`
+}
+
+func (in ExchangeRateInput) toRate() (ExchangeRate, error) {
+	currency := strings.ToUpper(in.Currency)
+	if !importCurrencies[currency] || currency == baseCurrency {
+		return ExchangeRate{}, fmt.Errorf("неподдерживаемая валюта: %s", in.Currency)
+	}
+	date, err := time.Parse(tariffDateLayout, in.Date)
+	if err != nil {
+		return ExchangeRate{}, fmt.Errorf("date: ожидается дата в формате %s", tariffDateLayout)
+	}
+	if in.Rate <= 0 {
+		return ExchangeRate{}, fmt.Errorf("курс %s должен быть больше нуля", currency)
+	}
+	return ExchangeRate{Currency: currency, Date: date, Rate: in.Rate}, nil
+}
+
+// курс валюты, действовавший на дату
+func findExchangeRate(db *gorm.DB, currency string, date time.Time) (ExchangeRate, error) {
+	if currency == baseCurrency {
+		return ExchangeRate{Currency: baseCurrency, Date: date, Rate: 1}, nil
+	}
+	var rate ExchangeRate
+	err := db.Where("currency = ? AND date <= ?", currency, date).Order("date DESC").First(&rate).Error
+	return rate, err
+}
+
+// сохранение курсов, курс на ту же дату заменяется
+func importExchangeRates(db *gorm.DB, inputs []ExchangeRateInput) ([]ExchangeRate, error) {
+	rates := make([]ExchangeRate, 0, len(inputs))
+	for i, in := range inputs {
+		rate, err := in.toRate()
+		if err != nil {
+			return nil, fmt.Errorf("курс %d: %w", i+1, err)
+		}
+		rates = append(rates, rate)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i := range rates {
+			var existing ExchangeRate
+			if tx.Where("currency = ? AND date = ?", rates[i].Currency, rates[i].Date).First(&existing).Error == nil {
+				rates[i].ID = existing.ID
+				rates[i].CreatedAt = existing.CreatedAt
+			} else {
+				rates[i].CreatedAt = time.Now()
+			}
+			if err := tx.Save(&rates[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return rates, err
+}
+
+// разбор файла курсов в JSON или YAML
+func parseExchangeRateFile(data []byte) ([]ExchangeRateInput, error) {
+	var inputs []ExchangeRateInput
+	if err := yaml.Unmarshal(data, &inputs); err != nil {
+		return nil, fmt.Errorf("не удалось разобрать файл курсов: %w", err)
+	}
+	return inputs, nil
+}
+
+// загрузка курсов из файла при запуске, путь задается в EXCHANGE_RATES_FILE
+func loadExchangeRatesFile(db *gorm.DB) error {
+	path := os.Getenv("EXCHANGE_RATES_FILE")
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	inputs, err := parseExchangeRateFile(data)
+	if err != nil {
+		return err
+	}
+	_, err = importExchangeRates(db, inputs)
+	return err
+}
+
+func SetupExchangeRateRoutes(adminRoutes *gin.RouterGroup, db *gorm.DB) {
+
+	// список курсов
+	adminRoutes.GET("/exchange-rates", func(c *gin.Context) {
+		query := db.Order("date DESC, currency")
+		if currency := c.Query("currency"); currency != "" {
+			query = query.Where("currency = ?", strings.ToUpper(currency))
+		}
+		var rates []ExchangeRate
+		query.Find(&rates)
+		c.JSON(http.StatusOK, rates)
+	})
+
+	// добавление или замена курса на дату
+	adminRoutes.POST("/exchange-rates", func(c *gin.Context) {
+		var input ExchangeRateInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rates, err := importExchangeRates(db, []ExchangeRateInput{input})
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, rates[0])
+	})
+
+	adminRoutes.DELETE("/exchange-rates/:id", func(c *gin.Context) {
+		db.Delete(&ExchangeRate{}, c.Param("id"))
+		c.JSON(http.StatusOK, gin.H{"message": "Курс удален"})
+	})
+
+	// импорт курсов из файла (поле file) или из тела запроса
+	adminRoutes.POST("/exchange-rates/import", func(c *gin.Context) {
+		data, err := readImportData(c)
+		if err != nil || len(data) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Файл не получен"})
+			return
+		}
+
+		inputs, err := parseExchangeRateFile(data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rates, err := importExchangeRates(db, inputs)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, rates)
+	})
+}
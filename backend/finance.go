@@ -0,0 +1,306 @@
+package main
+
+import (
+	"errors"
+	"math"
+)
+
+// типы финансовых продуктов
+const (
+	FinanceProductLoan    = "loan"
+	FinanceProductLease   = "lease"
+	FinanceProductBalloon = "balloon"
+)
+
+// условия варианта финансирования, влияющие на расчет
+type FinanceTerms struct {
+	ProductType          string  `json:"productType"`
+	InterestRate         float64 `json:"interestRate"`
+	MaxTerm              int     `json:"maxTerm"`
+	MinDownPayment       float64 `json:"minDownPayment"`
+	ResidualValuePercent float64 `json:"residualValuePercent"`
+	BalloonPercent       float64 `json:"balloonPercent"`
+}
+
+// снимок условий варианта финансирования
+func financeTermsOf(option FinanceOption) FinanceTerms {
+	return FinanceTerms{
+		ProductType:          option.ProductType,
+		InterestRate:         option.InterestRate,
+		MaxTerm:              option.MaxTerm,
+		MinDownPayment:       option.MinDownPayment,
+		ResidualValuePercent: option.ResidualValuePercent,
+		BalloonPercent:       option.BalloonPercent,
+	}
+}
+
+// вариант финансирования с условиями из снимка
+func (t FinanceTerms) apply(option FinanceOption) FinanceOption {
+	option.ProductType = t.ProductType
+	option.InterestRate = t.InterestRate
+	option.MaxTerm = t.MaxTerm
+	option.MinDownPayment = t.MinDownPayment
+	option.ResidualValuePercent = t.ResidualValuePercent
+	option.BalloonPercent = t.BalloonPercent
+	return option
+}
+
+// список условий, которые отличаются от снимка
+func (t FinanceTerms) changed(current FinanceTerms) []string {
+	var fields []string
+	if t.ProductType != current.ProductType {
+		fields = append(fields, "productType")
+	}
+	if t.InterestRate != current.InterestRate {
+		fields = append(fields, "interestRate")
+	}
+	if t.MaxTerm != current.MaxTerm {
+		fields = append(fields, "maxTerm")
+	}
+	if t.MinDownPayment != current.MinDownPayment {
+		fields = append(fields, "minDownPayment")
+	}
+	if t.ResidualValuePercent != current.ResidualValuePercent {
+		fields = append(fields, "residualValuePercent")
+	}
+	if t.BalloonPercent != current.BalloonPercent {
+		fields = append(fields, "balloonPercent")
+	}
+	return fields
+}
+
+// нарушение правила для поля запроса
+type FieldError struct {
+	Field   string   `json:"field"`
+	Rule    string   `json:"rule"`
+	Message string   `json:"message"`
+	Min     *float64 `json:"min,omitempty"`
+	Max     *float64 `json:"max,omitempty"`
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+// проверка параметров расчета по условиям варианта финансирования
+func validateFinanceRequest(option FinanceOption, carPrice, downPayment, tradeInValue Money, term int) []FieldError {
+	var errs []FieldError
+	if term < 1 || (option.MaxTerm > 0 && term > option.MaxTerm) {
+		errs = append(errs, FieldError{
+			Field:   "loanTerm",
+			Rule:    "maxTerm",
+			Message: "Срок должен быть от 1 до максимального срока продукта",
+			Min:     floatPtr(1),
+			Max:     floatPtr(float64(option.MaxTerm)),
+		})
+	}
+	if downPayment < 0 {
+		errs = append(errs, FieldError{
+			Field:   "downPayment",
+			Rule:    "nonNegative",
+			Message: "Первоначальный взнос не может быть отрицательным",
+			Min:     floatPtr(0),
+		})
+	}
+	if tradeInValue < 0 {
+		errs = append(errs, FieldError{
+			Field:   "tradeInValue",
+			Rule:    "nonNegative",
+			Message: "Стоимость trade-in не может быть отрицательной",
+			Min:     floatPtr(0),
+		})
+	}
+
+	minDownPayment := carPrice.Mul(option.MinDownPayment / 100)
+	if downPayment+tradeInValue < minDownPayment {
+		errs = append(errs, FieldError{
+			Field:   "downPayment",
+			Rule:    "minDownPayment",
+			Message: "Первоначальный взнос с учетом trade-in меньше минимального для продукта",
+			Min:     floatPtr(minDownPayment.Float()),
+			Max:     floatPtr(carPrice.Float()),
+		})
+	}
+
+	financed := carPrice - downPayment - tradeInValue
+	if financed <= 0 {
+		errs = append(errs, FieldError{
+			Field:   "downPayment",
+			Rule:    "loanAmount",
+			Message: "Первоначальный взнос и trade-in должны быть меньше цены автомобиля",
+			Max:     floatPtr((carPrice - 1).Float()),
+		})
+		return errs
+	}
+
+	// финансируемая сумма должна покрывать остаток в конце срока
+	var residual Money
+	switch option.ProductType {
+	case FinanceProductLease:
+		residual = carPrice.Mul(option.ResidualValuePercent / 100)
+	case FinanceProductBalloon:
+		residual = carPrice.Mul(option.BalloonPercent / 100)
+	}
+	if residual > 0 && financed <= residual {
+		errs = append(errs, FieldError{
+			Field:   "downPayment",
+			Rule:    "residualValue",
+			Message: "Финансируемая сумма должна превышать остаточный платеж продукта",
+			Max:     floatPtr((carPrice - residual - 1).Float()),
+		})
+	}
+	return errs
+}
+
+// расчет по финансовому продукту
+type financePlan struct {
+	MonthlyPayment Money
+	Schedule       []PaymentScheduleItem
+	ResidualValue  Money
+	BalloonPayment Money
+}
+
+// проверка параметров финансового продукта
+func validateFinanceOption(option *FinanceOption) error {
+	if option.ProductType == "" {
+		option.ProductType = FinanceProductLoan
+	}
+	if option.Name == "" {
+		return errors.New("Название продукта обязательно")
+	}
+	if option.InterestRate < 0 {
+		return errors.New("Процентная ставка не может быть отрицательной")
+	}
+	if option.MaxTerm <= 0 {
+		return errors.New("Максимальный срок должен быть больше нуля")
+	}
+	if option.MinDownPayment < 0 || option.MinDownPayment >= 100 {
+		return errors.New("Минимальный первоначальный взнос задается в процентах от 0 до 100")
+	}
+	switch option.ProductType {
+	case FinanceProductLoan:
+	case FinanceProductLease:
+		if option.ResidualValuePercent <= 0 || option.ResidualValuePercent >= 100 {
+			return errors.New("Остаточная стоимость лизинга задается в процентах от 0 до 100")
+		}
+		if option.MileageAllowance < 0 || option.ExcessMileageFee < 0 {
+			return errors.New("Лимит пробега и плата за перепробег не могут быть отрицательными")
+		}
+	case FinanceProductBalloon:
+		if option.BalloonPercent <= 0 || option.BalloonPercent >= 100 {
+			return errors.New("Остаточный платеж задается в процентах от 0 до 100")
+		}
+	default:
+		return errors.New("Неизвестный тип продукта: " + option.ProductType)
+	}
+	return nil
+}
+
+// аннуитетный платеж с остаточным платежом в конце срока
+func balloonAnnuityPayment(principal, balloon, monthlyRate float64, term int) float64 {
+	if monthlyRate > 0 {
+		return (principal - balloon/math.Pow(1+monthlyRate, float64(term))) * monthlyRate /
+			(1 - math.Pow(1+monthlyRate, -float64(term)))
+	}
+	return (principal - balloon) / float64(term)
+}
+
+// график кредита с остаточным платежом, после последнего платежа остается сумма balloon
+func buildBalloonSchedule(principal, balloon Money, payment Money, monthlyRate float64, term int, insurance Money) []PaymentScheduleItem {
+	schedule := make([]PaymentScheduleItem, 0, term)
+	balance := principal
+	for month := 1; month <= term; month++ {
+		interest := balance.Mul(monthlyRate)
+		principalPart := payment - interest
+		if month == term {
+			principalPart = balance - balloon
+		}
+		balance -= principalPart
+		schedule = append(schedule, PaymentScheduleItem{
+			Month:            month,
+			Payment:          principalPart + interest,
+			InterestPart:     interest,
+			PrincipalPart:    principalPart,
+			InsurancePayment: insurance,
+			RemainingBalance: balance,
+		})
+	}
+	return schedule
+}
+
+// график операционного лизинга: амортизация до остаточной стоимости и плата за пользование,
+// округление амортизации учитывается в последнем платеже
+func buildLeaseSchedule(capitalizedCost, residual Money, annualRate float64, term int, insurance Money) []PaymentScheduleItem {
+	depreciation := (capitalizedCost - residual).Div(term)
+	rentCharge := (capitalizedCost + residual).Mul(annualRate / 2400)
+	schedule := make([]PaymentScheduleItem, 0, term)
+	balance := capitalizedCost
+	for month := 1; month <= term; month++ {
+		principalPart := depreciation
+		if month == term {
+			principalPart = balance - residual
+		}
+		balance -= principalPart
+		schedule = append(schedule, PaymentScheduleItem{
+			Month:            month,
+			Payment:          principalPart + rentCharge,
+			InterestPart:     rentCharge,
+			PrincipalPart:    principalPart,
+			InsurancePayment: insurance,
+			RemainingBalance: balance,
+		})
+	}
+	return schedule
+}
+
+// платеж, посчитанный с плавающей точкой, округляется до копейки
+func roundPayment(payment float64) (Money, error) {
+	if math.IsNaN(payment) || math.IsInf(payment, 0) {
+		return 0, errors.New("Не удалось рассчитать платеж для указанных параметров")
+	}
+	rounded := moneyFromFloat(payment)
+	// платеж меньше копейки не погашает долг
+	if rounded <= 0 {
+		return 0, errors.New("Сумма финансирования слишком мала для расчета платежа")
+	}
+	return rounded, nil
+}
+
+// расчет платежей по типу продукта
+func buildFinancePlan(option FinanceOption, carPrice, financed Money, term int, insurance Money) (financePlan, error) {
+	monthlyRate := option.InterestRate / 100 / 12
+	switch option.ProductType {
+	case FinanceProductLease:
+		residual := carPrice.Mul(option.ResidualValuePercent / 100)
+		schedule := buildLeaseSchedule(financed, residual, option.InterestRate, term, insurance)
+		return financePlan{MonthlyPayment: schedule[0].Payment, Schedule: schedule, ResidualValue: residual}, nil
+	case FinanceProductBalloon:
+		balloon := carPrice.Mul(option.BalloonPercent / 100)
+		payment, err := roundPayment(balloonAnnuityPayment(financed.Float(), balloon.Float(), monthlyRate, term))
+		if err != nil {
+			return financePlan{}, err
+		}
+		return financePlan{
+			MonthlyPayment: payment,
+			Schedule:       buildBalloonSchedule(financed, balloon, payment, monthlyRate, term, insurance),
+			BalloonPayment: balloon,
+		}, nil
+	default:
+		payment, err := roundPayment(annuityPayment(financed.Float(), monthlyRate, term))
+		if err != nil {
+			return financePlan{}, err
+		}
+		return financePlan{
+			MonthlyPayment: payment,
+			Schedule:       buildPaymentSchedule(financed, payment, monthlyRate, term, insurance),
+		}, nil
+	}
+}
+
+// плата за перепробег по лизингу за весь срок
+func excessMileageCost(option FinanceOption, yearlyMileage, term int) Money {
+	if option.ProductType != FinanceProductLease || option.MileageAllowance <= 0 || yearlyMileage <= option.MileageAllowance {
+		return 0
+	}
+	return option.ExcessMileageFee.Times((yearlyMileage - option.MileageAllowance) * term).Div(12)
+}
@@ -0,0 +1,58 @@
+package main
+
+import "errors"
+
+// типы силовой установки
+const (
+	FuelPetrol   = "petrol"
+	FuelDiesel   = "diesel"
+	FuelHybrid   = "hybrid"
+	FuelElectric = "electric"
+)
+
+// киловатт в лошадиных силах
+const kwToHP = 1.35962
+
+// средний расход на 100 км и цена единицы энергии по умолчанию
+type energyProfile struct {
+	Unit           string
+	ConsumptionPer float64
+	Price          Money
+}
+
+var defaultEnergyProfiles = map[string]energyProfile{
+	FuelPetrol:   {Unit: "l", ConsumptionPer: 8.0, Price: rub(50)},
+	FuelDiesel:   {Unit: "l", ConsumptionPer: 7.0, Price: rub(60)},
+	FuelHybrid:   {Unit: "l", ConsumptionPer: 5.0, Price: rub(50)},
+	FuelElectric: {Unit: "kWh", ConsumptionPer: 18.0, Price: rub(6)},
+}
+
+// нормализация и проверка типа силовой установки, пустой тип считается бензиновым
+func normalizeFuelType(fuelType string) (string, error) {
+	if fuelType == "" {
+		return FuelPetrol, nil
+	}
+	if _, ok := defaultEnergyProfiles[fuelType]; !ok {
+		return "", errors.New("Неизвестный тип силовой установки: " + fuelType)
+	}
+	return fuelType, nil
+}
+
+// проверка характеристик электромобиля
+func validateCarPowertrain(car *Car) error {
+	fuelType, err := normalizeFuelType(car.FuelType)
+	if err != nil {
+		return err
+	}
+	car.FuelType = fuelType
+	if car.FuelConsumption < 0 {
+		return errors.New("Расход не может быть отрицательным")
+	}
+	if car.BatteryCapacity < 0 || car.ElectricPower < 0 {
+		return errors.New("Емкость батареи и мощность электромотора не могут быть отрицательными")
+	}
+	if fuelType == FuelElectric && (car.BatteryCapacity == 0 || car.ElectricPower == 0) {
+		return errors.New("Для электромобиля нужны емкость батареи (кВт·ч) и мощность (кВт)")
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// что блокируется после неудачных попыток входа
+const (
+	LockKindUsername = "username"
+	LockKindIP       = "ip"
+)
+
+// причины неудачного входа
+const (
+	LoginFailureBadPassword = "bad_password"
+	LoginFailureUnknownUser = "unknown_user"
+	LoginFailureLocked      = "locked"
+)
+
+// настройки блокировки входа
+type LockoutConfig struct {
+	MaxFailures   int    `json:"maxFailures" yaml:"maxFailures"`
+	IPMaxFailures int    `json:"ipMaxFailures" yaml:"ipMaxFailures"`
+	Duration      string `json:"duration" yaml:"duration"`
+	MaxDuration   string `json:"maxDuration" yaml:"maxDuration"`
+	Window        string `json:"window" yaml:"window"`
+}
+
+// Неудачная попытка входа, записи только добавляются
+type LoginAttempt struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Username  string    `json:"username" gorm:"index"`
+	IP        string    `json:"ip" gorm:"index"`
+	UserAgent string    `json:"userAgent"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt" gorm:"index"`
+}
+
+// Счетчик неудач и блокировка по имени пользователя или IP
+type LoginLock struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Kind          string     `json:"kind" gorm:"uniqueIndex:idx_login_lock"`
+	Value         string     `json:"value" gorm:"uniqueIndex:idx_login_lock"`
+	Failures      int        `json:"failures"`
+	LockedUntil   *time.Time `json:"lockedUntil"`
+	LastFailureAt time.Time  `json:"lastFailureAt"`
+}
+
+// Защита входа: после maxFailures неудач подряд вход блокируется на duration,
+// каждая следующая неудача удваивает срок до maxDuration;
+// счетчик сбрасывается после успешного входа или через window без неудач
+type LoginGuard struct {
+	maxFailures   int
+	ipMaxFailures int
+	duration      time.Duration
+	maxDuration   time.Duration
+	window        time.Duration
+}
+
+var loginGuard = LoginGuard{
+	maxFailures:   5,
+	ipMaxFailures: 20,
+	duration:      15 * time.Minute,
+	maxDuration:   24 * time.Hour,
+	window:        time.Hour,
+}
+
+func newLoginGuard(cfg LockoutConfig) (LoginGuard, error) {
+	guard := loginGuard
+	if cfg.MaxFailures > 0 {
+		guard.maxFailures = cfg.MaxFailures
+	}
+	if cfg.IPMaxFailures > 0 {
+		guard.ipMaxFailures = cfg.IPMaxFailures
+	}
+	durations := []struct {
+		name  string
+		value string
+		field *time.Duration
+	}{
+		{"LOGIN_LOCKOUT", cfg.Duration, &guard.duration},
+		{"LOGIN_LOCKOUT_MAX", cfg.MaxDuration, &guard.maxDuration},
+		{"LOGIN_FAILURE_WINDOW", cfg.Window, &guard.window},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil || parsed <= 0 {
+			return guard, fmt.Errorf("некорректное значение %s: %s", d.name, d.value)
+		}
+		*d.field = parsed
+	}
+	if guard.maxDuration < guard.duration {
+		guard.maxDuration = guard.duration
+	}
+	return guard, nil
+}
+
+func normalizeLoginName(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// оставшееся время блокировки по имени пользователя или IP
+func (g LoginGuard) lockedFor(db *gorm.DB, username, ip string) time.Duration {
+	var locks []LoginLock
+	db.Where("(kind = ? AND value = ?) OR (kind = ? AND value = ?)",
+		LockKindUsername, normalizeLoginName(username), LockKindIP, ip).
+		Where("locked_until > ?", time.Now()).Find(&locks)
+
+	var remaining time.Duration
+	for _, lock := range locks {
+		if left := time.Until(*lock.LockedUntil); left > remaining {
+			remaining = left
+		}
+	}
+	return remaining
+}
+
+// срок блокировки удваивается с каждой неудачей сверх порога
+func (g LoginGuard) lockDuration(overLimit int) time.Duration {
+	d := float64(g.duration) * math.Pow(2, float64(overLimit))
+	if d > float64(g.maxDuration) {
+		return g.maxDuration
+	}
+	return time.Duration(d)
+}
+
+func (g LoginGuard) countFailure(db *gorm.DB, kind, value string, limit int) time.Duration {
+	now := time.Now()
+	var lock LoginLock
+	db.Where(LoginLock{Kind: kind, Value: value}).FirstOrCreate(&lock)
+
+	if now.Sub(lock.LastFailureAt) > g.window && (lock.LockedUntil == nil || lock.LockedUntil.Before(now)) {
+		lock.Failures = 0
+	}
+	lock.Failures++
+	lock.LastFailureAt = now
+
+	var locked time.Duration
+	if lock.Failures >= limit {
+		locked = g.lockDuration(lock.Failures - limit)
+		until := now.Add(locked)
+		lock.LockedUntil = &until
+	}
+	db.Save(&lock)
+	return locked
+}
+
+// учет неудачной попытки; возвращает срок блокировки, если она наступила
+func (g LoginGuard) fail(c *gin.Context, db *gorm.DB, username, reason string) time.Duration {
+	db.Create(&LoginAttempt{
+		Username:  username,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	})
+	if reason == LoginFailureLocked {
+		return 0
+	}
+	locked := g.countFailure(db, LockKindUsername, normalizeLoginName(username), g.maxFailures)
+	if ipLocked := g.countFailure(db, LockKindIP, c.ClientIP(), g.ipMaxFailures); ipLocked > locked {
+		locked = ipLocked
+	}
+	return locked
+}
+
+// успешный вход сбрасывает счетчик по имени пользователя
+func (g LoginGuard) succeed(db *gorm.DB, username string) {
+	db.Where("kind = ? AND value = ?", LockKindUsername, normalizeLoginName(username)).Delete(&LoginLock{})
+}
+
+func respondLoginLocked(c *gin.Context, remaining time.Duration) {
+	seconds := int(math.Ceil(remaining.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":      "Слишком много неудачных попыток входа, повторите позже",
+		"retryAfter": seconds,
+	})
+}
+
+func SetupLoginGuardRoutes(userAdminRoutes *gin.RouterGroup, db *gorm.DB) {
+
+	// журнал неудачных попыток входа
+	userAdminRoutes.GET("/login-attempts", func(c *gin.Context) {
+		query := db.Order("created_at DESC, id DESC")
+		if username := c.Query("username"); username != "" {
+			query = query.Where("LOWER(username) = ?", normalizeLoginName(username))
+		}
+		if ip := c.Query("ip"); ip != "" {
+			query = query.Where("ip = ?", ip)
+		}
+		if from := c.Query("from"); from != "" {
+			date, err := time.Parse(tariffDateLayout, from)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Дата from должна быть в формате 2006-01-02"})
+				return
+			}
+			query = query.Where("created_at >= ?", date)
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit < 1 || limit > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit должен быть от 1 до 1000"})
+			return
+		}
+		var attempts []LoginAttempt
+		query.Limit(limit).Find(&attempts)
+		c.JSON(http.StatusOK, attempts)
+	})
+
+	// действующие блокировки
+	userAdminRoutes.GET("/login-locks", func(c *gin.Context) {
+		var locks []LoginLock
+		db.Where("locked_until > ?", time.Now()).Order("locked_until DESC").Find(&locks)
+		c.JSON(http.StatusOK, locks)
+	})
+
+	// снятие блокировки по имени пользователя или IP
+	userAdminRoutes.DELETE("/login-locks/:id", func(c *gin.Context) {
+		result := db.Delete(&LoginLock{}, c.Param("id"))
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Блокировка не найдена"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Блокировка снята"})
+	})
+
+	// разблокировка учетной записи
+	userAdminRoutes.POST("/users/:id/unlock", func(c *gin.Context) {
+		var user User
+		if err := db.First(&user, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+			return
+		}
+		loginGuard.succeed(db, user.Username)
+		c.JSON(http.StatusOK, gin.H{"message": "Учетная запись разблокирована"})
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// письмо пользователю
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+	SentAt  time.Time
+}
+
+// способ отправки писем: SMTP в рабочем окружении,
+// файл или память для разработки и тестов
+type MailSender interface {
+	Send(msg Email) error
+}
+
+// настройки отправки писем
+type MailConfig struct {
+	Transport    string `json:"transport" yaml:"transport"`
+	From         string `json:"from" yaml:"from"`
+	OutboxDir    string `json:"outboxDir" yaml:"outboxDir"`
+	SMTPHost     string `json:"smtpHost" yaml:"smtpHost"`
+	SMTPPort     string `json:"smtpPort" yaml:"smtpPort"`
+	SMTPUsername string `json:"smtpUsername" yaml:"smtpUsername"`
+	SMTPPassword string `json:"smtpPassword" yaml:"smtpPassword"`
+}
+
+var mailer MailSender
+
+func newMailSender(cfg MailConfig, dev bool) (MailSender, error) {
+	transport := cfg.Transport
+	if transport == "" {
+		transport = "file"
+		if cfg.SMTPHost != "" {
+			transport = "smtp"
+		}
+	}
+
+	switch transport {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("не задан SMTP_HOST")
+		}
+		port := cfg.SMTPPort
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPMailSender{Addr: net.JoinHostPort(cfg.SMTPHost, port), Host: cfg.SMTPHost,
+			Username: cfg.SMTPUsername, Password: cfg.SMTPPassword, From: cfg.From}, nil
+	case "file":
+		dir := cfg.OutboxDir
+		if dir == "" {
+			dir = "outbox"
+		}
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, err
+		}
+		if !dev {
+			log.Println("ВНИМАНИЕ: письма сохраняются в каталог", dir, "- для отправки укажите SMTP_HOST")
+		}
+		return &FileMailSender{Dir: dir}, nil
+	case "memory":
+		return &MemoryMailSender{}, nil
+	}
+	return nil, fmt.Errorf("неизвестный способ отправки писем: %s", transport)
+}
+
+// отправка через SMTP-сервер
+type SMTPMailSender struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPMailSender) Send(msg Email) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	data := "From: " + s.From + "\r\n" +
+		"To: " + msg.To + "\r\n" +
+		"Subject: " + msg.Subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n" +
+		strings.ReplaceAll(msg.Body, "\n", "\r\n")
+	return smtp.SendMail(s.Addr, auth, s.From, []string{msg.To}, []byte(data))
+}
+
+// письма сохраняются файлами в каталог, для локальной разработки
+type FileMailSender struct {
+	Dir string
+	mu  sync.Mutex
+	seq int
+}
+
+func (s *FileMailSender) Send(msg Email) error {
+	s.mu.Lock()
+	s.seq++
+	name := fmt.Sprintf("%s-%03d.txt", time.Now().Format("20060102-150405"), s.seq)
+	s.mu.Unlock()
+
+	data := "To: " + msg.To + "\nSubject: " + msg.Subject + "\n\n" + msg.Body + "\n"
+	return os.WriteFile(filepath.Join(s.Dir, name), []byte(data), 0o600)
+}
+
+// письма остаются в памяти, для тестов
+type MemoryMailSender struct {
+	mu       sync.Mutex
+	messages []Email
+}
+
+func (s *MemoryMailSender) Send(msg Email) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg.SentAt = time.Now()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func (s *MemoryMailSender) Messages() []Email {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Email(nil), s.messages...)
+}
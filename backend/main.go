@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -15,19 +16,26 @@ import (
 	"gorm.io/gorm"
 )
 
-var jwtSecret = []byte("secret_key_autosalon_2023")
-
 // Модель пользователя для авторизации
 type User struct {
-	ID           uint       `json:"id" gorm:"primaryKey"`
-	Username     string     `json:"username" gorm:"unique"`
-	Password     string     `json:"password,omitempty" gorm:"-"`
-	PasswordHash string     `json:"-" gorm:"column:password"`
-	Email        string     `json:"email"`
-	FullName     string     `json:"fullName"`
-	IsAdmin      bool       `json:"isAdmin"`
-	LastLogin    *time.Time `json:"lastLogin"`
-	CreatedAt    time.Time  `json:"createdAt"`
+	ID                 uint       `json:"id" gorm:"primaryKey"`
+	Username           string     `json:"username" gorm:"unique"`
+	Password           string     `json:"password,omitempty" gorm:"-"`
+	PasswordHash       string     `json:"-" gorm:"column:password"`
+	Email              string     `json:"email"`
+	EmailVerified      bool       `json:"emailVerified"`
+	FullName           string     `json:"fullName"`
+	IsAdmin            bool       `json:"isAdmin"`
+	MustChangePassword bool       `json:"mustChangePassword"`
+	Role               string     `json:"role" gorm:"default:customer"`
+	ShopID             *uint      `json:"shopId"`
+	CustomerID         *uint      `json:"customerId" gorm:"index"`
+	TokenVersion       int        `json:"-" gorm:"default:0"`
+	TOTPEnabled        bool       `json:"totpEnabled"`
+	TOTPSecret         string     `json:"-"`
+	TOTPLastStep       int64      `json:"-"`
+	LastLogin          *time.Time `json:"lastLogin"`
+	CreatedAt          time.Time  `json:"createdAt"`
 }
 
 // Структура для авторизации
@@ -48,23 +56,30 @@ type RegisterRequest struct {
 type JWTClaims struct {
 	Username string `json:"username"`
 	IsAdmin  bool   `json:"isAdmin"`
+	Role     string `json:"role"`
+	ShopID   *uint  `json:"shopId,omitempty"`
+	// версия токенов пользователя, увеличивается при отзыве всех сессий
+	TokenVersion int `json:"ver"`
 	jwt.RegisteredClaims
 }
 
-// генерация JWT
-func generateToken(user User) (string, error) {
+// генерация короткоживущего access-токена для сессии
+func generateToken(user User, sessionID string) (string, error) {
 	claims := JWTClaims{
-		Username: user.Username,
-		IsAdmin:  user.IsAdmin,
+		Username:     user.Username,
+		IsAdmin:      user.IsAdmin,
+		Role:         userRole(user),
+		ShopID:       user.ShopID,
+		TokenVersion: user.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        sessionID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtSecret)
+	tokenString, err := signingKeys.sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -87,9 +102,7 @@ func authMiddleware() gin.HandlerFunc {
 			tokenString = tokenString[7:]
 		}
 
-		token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
+		token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, signingKeys.keyFunc)
 
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Недействительный токен"})
@@ -98,8 +111,34 @@ func authMiddleware() gin.HandlerFunc {
 		}
 
 		if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
+			user, active := checkTokenRevocation(c.MustGet("db").(*gorm.DB), claims)
+			if !active {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Токен отозван"})
+				c.Abort()
+				return
+			}
+			if user.MustChangePassword && !passwordChangeAllowedPaths[c.FullPath()] {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Необходимо сменить пароль", "mustChangePassword": true})
+				c.Abort()
+				return
+			}
+			if twoFactorSetupRequired(user) && !twoFactorSetupAllowedPaths[c.FullPath()] {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Необходимо включить двухфакторную аутентификацию", "twoFactorSetupRequired": true})
+				c.Abort()
+				return
+			}
+			c.Set("userId", user.ID)
+			c.Set("sessionId", claims.ID)
 			c.Set("username", claims.Username)
 			c.Set("isAdmin", claims.IsAdmin)
+			role := claims.Role
+			if role == "" {
+				role = userRole(User{IsAdmin: claims.IsAdmin})
+			}
+			c.Set("role", role)
+			if claims.ShopID != nil {
+				c.Set("shopId", *claims.ShopID)
+			}
 			c.Next()
 		} else {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Недействительный токен"})
@@ -109,19 +148,6 @@ func authMiddleware() gin.HandlerFunc {
 	}
 }
 
-// мидлварь проверки на админа
-func adminMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		isAdmin, exists := c.Get("isAdmin")
-		if !exists || isAdmin != true {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Требуются права администратора"})
-			c.Abort()
-			return
-		}
-		c.Next()
-	}
-}
-
 // Модель автосалона
 type Shop struct {
 	ID          uint   `json:"id" gorm:"primaryKey"`
@@ -134,8 +160,9 @@ type Shop struct {
 
 // Модель марки
 type CarBrand struct {
-	ID   uint   `json:"id" gorm:"primaryKey"`
-	Name string `json:"name"`
+	ID               uint   `json:"id" gorm:"primaryKey"`
+	Name             string `json:"name"`
+	ServiceProfileID *uint  `json:"serviceProfileId"`
 }
 
 // Модель модели
@@ -144,25 +171,39 @@ type CarModel struct {
 	BrandID uint     `json:"brandId"`
 	Name    string   `json:"name"`
 	Brand   CarBrand `json:"brand" gorm:"foreignKey:BrandID"`
+
+	// типовой расход на 100 км для модели
+	FuelConsumption float64 `json:"fuelConsumption"`
 }
 
 // Модель автомобиля
 type Car struct {
-	ID           uint      `json:"id" gorm:"primaryKey"`
-	BrandID      uint      `json:"brandId"`
-	ModelID      uint      `json:"modelId"`
-	Year         int       `json:"year"`
-	EnginePower  int       `json:"enginePower"`
-	Transmission string    `json:"transmission"`
+	ID           uint   `json:"id" gorm:"primaryKey"`
+	BrandID      uint   `json:"brandId"`
+	ModelID      uint   `json:"modelId"`
+	Year         int    `json:"year"`
+	EnginePower  int    `json:"enginePower"`
+	Transmission string `json:"transmission"`
+
+	// силовая установка: petrol, diesel, hybrid, electric; емкость батареи в кВт·ч, мощность электромотора в кВт
+	FuelType        string  `json:"fuelType" gorm:"default:petrol"`
+	BatteryCapacity float64 `json:"batteryCapacity"`
+	ElectricPower   int     `json:"electricPower"`
+	// расход на 100 км: литры или кВт·ч, 0 - брать из модели
+	FuelConsumption float64 `json:"fuelConsumption"`
+
 	Condition    string    `json:"condition"`
 	Mileage      int       `json:"mileage"`
 	Color        string    `json:"color"`
-	VIN          string    `json:"vin" gorm:"-"`
-	Price        int       `json:"price"`
+	VIN          string    `json:"vin"`
+	Price        Money     `json:"price"`
 	ShopID       uint      `json:"shopId"`
 	InStock      bool      `json:"inStock"`
+	OnInspection bool      `json:"onInspection"`
 	ArrivalDate  time.Time `json:"arrivalDate"`
 	ImagePath    string    `json:"imagePath"`
+	// мягкое удаление: продажи и расчеты продолжают ссылаться на запись
+	DeletedAt gorm.DeletedAt `json:"deletedAt" gorm:"index"`
 
 	Brand CarBrand `json:"brand" gorm:"foreignKey:BrandID"`
 	Model CarModel `json:"model" gorm:"foreignKey:ModelID"`
@@ -181,10 +222,12 @@ type Customer struct {
 	YearFrom       int        `json:"yearFrom"`
 	YearTo         int        `json:"yearTo"`
 	Condition      string     `json:"condition"`
-	MaxPrice       int        `json:"maxPrice"`
+	MaxPrice       Money      `json:"maxPrice"`
 	LastContact    *time.Time `json:"lastContact"`
 	Notes          string     `json:"notes"`
 	Status         string     `json:"status"`
+
+	DeletedAt gorm.DeletedAt `json:"deletedAt" gorm:"index"`
 }
 
 // Модель сотрудника
@@ -196,7 +239,9 @@ type Employee struct {
 	Phone    string    `json:"phone"`
 	Email    string    `json:"email"`
 	HireDate time.Time `json:"hireDate"`
-	Salary   int       `json:"salary"`
+	Salary   Money     `json:"salary"`
+
+	DeletedAt gorm.DeletedAt `json:"deletedAt" gorm:"index"`
 
 	Shop Shop `json:"shop" gorm:"foreignKey:ShopID"`
 }
@@ -208,10 +253,15 @@ type Sale struct {
 	CustomerID  uint      `json:"customerId"`
 	ShopID      uint      `json:"shopId"`
 	SaleDate    time.Time `json:"saleDate"`
-	SalePrice   int       `json:"salePrice"`
+	SalePrice   Money     `json:"salePrice"`
 	PaymentType string    `json:"paymentType"`
 	EmployeeID  uint      `json:"employeeId"`
 
+	Status       string     `json:"status" gorm:"default:completed"`
+	CancelReason string     `json:"cancelReason"`
+	RefundAmount Money      `json:"refundAmount" gorm:"default:0"`
+	CancelledAt  *time.Time `json:"cancelledAt"`
+
 	Car      Car      `json:"car" gorm:"foreignKey:CarID"`
 	Customer Customer `json:"customer" gorm:"foreignKey:CustomerID"`
 	Shop     Shop     `json:"shop" gorm:"foreignKey:ShopID"`
@@ -222,10 +272,19 @@ type Sale struct {
 type FinanceOption struct {
 	ID             uint    `json:"id" gorm:"primaryKey"`
 	Name           string  `json:"name"`
+	ProductType    string  `json:"productType" gorm:"default:loan"`
 	MinDownPayment float64 `json:"minDownPayment"`
 	MaxTerm        int     `json:"maxTerm"`
 	InterestRate   float64 `json:"interestRate"`
 	Description    string  `json:"description"`
+
+	// лизинг: остаточная стоимость в процентах от цены, годовой лимит пробега и плата за км сверх лимита
+	ResidualValuePercent float64 `json:"residualValuePercent"`
+	MileageAllowance     int     `json:"mileageAllowance"`
+	ExcessMileageFee     Money   `json:"excessMileageFee"`
+
+	// кредит с остаточным платежом: платеж в конце срока в процентах от цены
+	BalloonPercent float64 `json:"balloonPercent"`
 }
 
 // Модель расчета стоимости
@@ -234,12 +293,18 @@ type CostCalculation struct {
 	CarID           uint      `json:"carId"`
 	CustomerID      uint      `json:"customerId"`
 	FinanceOptionID uint      `json:"financeOptionId"`
-	DownPayment     int       `json:"downPayment"`
+	DownPayment     Money     `json:"downPayment"`
 	LoanTerm        int       `json:"loanTerm"`
-	InsuranceCost   int       `json:"insuranceCost"`
-	TradeInValue    int       `json:"tradeInValue"`
+	InsuranceCost   Money     `json:"insuranceCost"`
+	TradeInValue    Money     `json:"tradeInValue"`
 	CreatedAt       time.Time `json:"createdAt"`
 
+	// условия на момент расчета
+	CarPrice       Money        `json:"carPrice"`
+	HasInsurance   bool         `json:"hasInsurance"`
+	MonthlyPayment Money        `json:"monthlyPayment"`
+	Terms          FinanceTerms `json:"terms" gorm:"embedded;embeddedPrefix:terms_"`
+
 	Car           Car           `json:"car" gorm:"foreignKey:CarID"`
 	Customer      Customer      `json:"customer" gorm:"foreignKey:CustomerID"`
 	FinanceOption FinanceOption `json:"financeOption" gorm:"foreignKey:FinanceOptionID"`
@@ -256,6 +321,35 @@ type Favorite struct {
 	Car  Car  `json:"car" gorm:"foreignKey:CarID"`
 }
 
+// выдача токенов после успешной проверки пароля и второго фактора
+func completeLogin(c *gin.Context, db *gorm.DB, user User) {
+	tokens, err := startSession(c, db, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания токена"})
+		return
+	}
+
+	now := time.Now()
+	user.LastLogin = &now
+	db.Save(&user)
+
+	tokens["user"] = gin.H{
+		"id":                     user.ID,
+		"username":               user.Username,
+		"isAdmin":                user.IsAdmin,
+		"role":                   userRole(user),
+		"mustChangePassword":     user.MustChangePassword,
+		"emailVerified":          user.EmailVerified,
+		"totpEnabled":            user.TOTPEnabled,
+		"twoFactorSetupRequired": twoFactorSetupRequired(user),
+		"shopId":                 user.ShopID,
+		"customerId":             user.CustomerID,
+		"fullName":               user.FullName,
+		"email":                  user.Email,
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
 // обработка загрузки файлов
 func handleFileUpload(c *gin.Context) {
 	file, err := c.FormFile("image")
@@ -279,6 +373,27 @@ func handleFileUpload(c *gin.Context) {
 }
 
 func main() {
+	authConfig, err := loadAuthConfig()
+	if err != nil {
+		log.Fatal("Ошибка чтения настроек авторизации:", err)
+	}
+	signingKeys, err = buildKeyring(authConfig)
+	if err != nil {
+		log.Fatal("Ошибка настройки ключей подписи:", err)
+	}
+	passwordPolicy, err = loadPasswordPolicy(authConfig)
+	if err != nil {
+		log.Fatal("Ошибка загрузки списка утекших паролей:", err)
+	}
+	mailer, err = newMailSender(authConfig.Mail, authConfig.isDev())
+	if err != nil {
+		log.Fatal("Ошибка настройки отправки писем:", err)
+	}
+	loginGuard, err = newLoginGuard(authConfig.Lockout)
+	if err != nil {
+		log.Fatal("Ошибка настройки блокировки входа:", err)
+	}
+
 	r := gin.Default()
 
 	r.Use(cors.New(cors.Config{
@@ -298,16 +413,52 @@ func main() {
 		log.Fatal("Ошибка подключения к базе данных:", err)
 	}
 
+	var clock Clock = systemClock{}
 	r.Use(func(c *gin.Context) {
 		c.Set("db", db)
+		c.Set("clock", clock)
 		c.Next()
 	})
 
 	db.AutoMigrate(&Shop{}, &CarBrand{}, &CarModel{}, &Car{}, &Customer{},
-		&Employee{}, &Sale{}, &FinanceOption{}, &CostCalculation{}, &User{}, &Favorite{})
+		&Employee{}, &Sale{}, &FinanceOption{}, &CostCalculation{}, &User{}, &Favorite{},
+		&TariffTable{}, &ExchangeRate{}, &ServiceProfile{}, &TransportTaxRegion{}, &Session{}, &UserToken{},
+		&LoginAttempt{}, &LoginLock{}, &RecoveryCode{}, &SecurityPolicy{}, &AuditEntry{})
+
+	// уникальность VIN только для заполненных значений
+	db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_cars_vin ON cars(vin) WHERE vin <> ''")
+
+	if err := protectAuditLog(db); err != nil {
+		log.Fatal("Ошибка защиты журнала изменений:", err)
+	}
+
+	if err := migrateAdminRoles(db); err != nil {
+		log.Println("Ошибка назначения ролей администраторам:", err)
+	}
 
-	if err := createDefaultAdmin(db); err != nil {
-		log.Println("Ошибка создания администратора:", err)
+	if err := loadSecurityPolicy(db); err != nil {
+		log.Fatal("Ошибка загрузки политики безопасности:", err)
+	}
+
+	if err := requireDefaultPasswordChange(db, authConfig); err != nil {
+		log.Println("Ошибка проверки паролей по умолчанию:", err)
+	}
+
+	// без владельца управлять системой некому, поэтому ошибка останавливает запуск
+	if err := createDefaultAdmin(db, authConfig); err != nil {
+		log.Fatal("Ошибка создания администратора: ", err)
+	}
+
+	if err := createDefaultTariff(db); err != nil {
+		log.Println("Ошибка создания тарифа по умолчанию:", err)
+	}
+
+	if err := createDefaultOwnershipData(db); err != nil {
+		log.Println("Ошибка создания профилей обслуживания и налоговых ставок:", err)
+	}
+
+	if err := loadExchangeRatesFile(db); err != nil {
+		log.Println("Ошибка загрузки курсов валют:", err)
 	}
 
 	// авторизация
@@ -318,39 +469,51 @@ func main() {
 			return
 		}
 
+		if remaining := loginGuard.lockedFor(db, loginReq.Username, c.ClientIP()); remaining > 0 {
+			loginGuard.fail(c, db, loginReq.Username, LoginFailureLocked)
+			respondLoginLocked(c, remaining)
+			return
+		}
+
 		var user User
 		result := db.Where("username = ?", loginReq.Username).First(&user)
 		if result.Error != nil {
+			if locked := loginGuard.fail(c, db, loginReq.Username, LoginFailureUnknownUser); locked > 0 {
+				respondLoginLocked(c, locked)
+				return
+			}
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверное имя пользователя или пароль"})
 			return
 		}
 
 		err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(loginReq.Password))
 		if err != nil {
+			if locked := loginGuard.fail(c, db, loginReq.Username, LoginFailureBadPassword); locked > 0 {
+				respondLoginLocked(c, locked)
+				return
+			}
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверное имя пользователя или пароль"})
 			return
 		}
 
-		token, err := generateToken(user)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания токена"})
+		// при включенной 2FA вход завершается кодом через /api/auth/login/2fa;
+		// счетчик неудач сбрасывается только после кода, иначе пароль обнулял бы попытки подбора кода
+		if user.TOTPEnabled {
+			challenge, err := issueUserToken(db, user.ID, TokenPurposeLoginChallenge, loginChallengeTTL)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания токена"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"twoFactorRequired": true,
+				"challengeToken":    challenge,
+				"expiresIn":         int(loginChallengeTTL.Seconds()),
+			})
 			return
 		}
 
-		now := time.Now()
-		user.LastLogin = &now
-		db.Save(&user)
-
-		c.JSON(http.StatusOK, gin.H{
-			"token": token,
-			"user": gin.H{
-				"id":       user.ID,
-				"username": user.Username,
-				"isAdmin":  user.IsAdmin,
-				"fullName": user.FullName,
-				"email":    user.Email,
-			},
-		})
+		loginGuard.succeed(db, user.Username)
+		completeLogin(c, db, user)
 	})
 
 	// регистрация
@@ -374,6 +537,11 @@ func main() {
 			return
 		}
 
+		if err := passwordPolicy.validate(registerReq.Password, registerReq.Username, registerReq.Email); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+
 		passwordHash, err := bcrypt.GenerateFromPassword([]byte(registerReq.Password), bcrypt.DefaultCost)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при обработке пароля"})
@@ -386,6 +554,7 @@ func main() {
 			Email:        registerReq.Email,
 			FullName:     registerReq.FullName,
 			IsAdmin:      false,
+			Role:         RoleCustomer,
 			CreatedAt:    time.Now(),
 		}
 
@@ -394,23 +563,34 @@ func main() {
 			return
 		}
 
-		token, err := generateToken(newUser)
+		// карточка клиента с тем же email или новая
+		if err := linkCustomer(db, &newUser); err != nil && !errors.Is(err, errEmailNotVerified) {
+			log.Println("Ошибка привязки пользователя к клиенту:", err)
+		}
+
+		if err := sendVerificationEmail(db, authConfig, newUser); err != nil {
+			log.Println("Ошибка отправки письма с подтверждением:", err)
+		}
+
+		tokens, err := startSession(c, db, newUser)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания токена"})
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{
-			"token": token,
-			"user": gin.H{
-				"id":       newUser.ID,
-				"username": newUser.Username,
-				"isAdmin":  newUser.IsAdmin,
-				"fullName": newUser.FullName,
-				"email":    newUser.Email,
-			},
-			"message": "Регистрация прошла успешно",
-		})
+		tokens["user"] = gin.H{
+			"id":            newUser.ID,
+			"username":      newUser.Username,
+			"isAdmin":       newUser.IsAdmin,
+			"role":          newUser.Role,
+			"emailVerified": newUser.EmailVerified,
+			"shopId":        newUser.ShopID,
+			"customerId":    newUser.CustomerID,
+			"fullName":      newUser.FullName,
+			"email":         newUser.Email,
+		}
+		tokens["message"] = "Регистрация прошла успешно, подтвердите email по ссылке из письма"
+		c.JSON(http.StatusCreated, tokens)
 	})
 
 	// проверка токена
@@ -422,48 +602,108 @@ func main() {
 		})
 	})
 
+	// подтверждение email и восстановление пароля
+	SetupAccountRoutes(r, db, authConfig)
+
 	SetupCalculatorRoutes(r)
 
 	// маршруты админки
 	adminRoutes := r.Group("/api/admin")
-	adminRoutes.Use(authMiddleware(), adminMiddleware())
+	adminRoutes.Use(authMiddleware(), auditMiddleware(db))
 	{
+		// группы маршрутов по правам ролей
+		carRoutes := adminRoutes.Group("", requirePermission(PermCarsWrite))
+		catalogRoutes := adminRoutes.Group("", requirePermission(PermCatalogWrite))
+		customerRoutes := adminRoutes.Group("", requirePermission(PermCustomersWrite))
+		employeeRoutes := adminRoutes.Group("", requirePermission(PermEmployeesWrite))
+		saleRoutes := adminRoutes.Group("", requirePermission(PermSalesWrite))
+		financeRoutes := adminRoutes.Group("", requirePermission(PermFinanceWrite))
+		userAdminRoutes := adminRoutes.Group("", requirePermission(PermUsersManage))
+		auditRoutes := adminRoutes.Group("", requirePermission(PermAuditRead))
 
 		// CRUD автомобиля
-		adminRoutes.POST("/cars", func(c *gin.Context) {
+		carRoutes.POST("/cars", func(c *gin.Context) {
 			var car Car
 			if err := c.ShouldBindJSON(&car); err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
-			db.Create(&car)
+			// удаление и восстановление только через отдельные маршруты
+			car.DeletedAt = gorm.DeletedAt{}
+			if !checkShopAccess(c, car.ShopID) {
+				return
+			}
+			if err := validateCarPowertrain(&car); err != nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+				return
+			}
+			if !checkCarVIN(c, db, &car) {
+				return
+			}
+			if err := db.Create(&car).Error; err != nil {
+				if isVINConflict(err) {
+					c.JSON(http.StatusConflict, gin.H{"error": vinTakenMessage})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при создании автомобиля"})
+				return
+			}
 			c.JSON(http.StatusCreated, car)
 		})
 
-		adminRoutes.PUT("/cars/:id", func(c *gin.Context) {
+		// расшифровка VIN
+		carRoutes.POST("/cars/decode-vin", decodeVINHandler(db))
+
+		carRoutes.PUT("/cars/:id", func(c *gin.Context) {
 			var car Car
-			id := c.Param("id")
-			db.First(&car, id)
+			db.First(&car, c.Param("id"))
 			if car.ID == 0 {
 				c.JSON(http.StatusNotFound, gin.H{"error": "Автомобиль не найден"})
 				return
 			}
+			if !checkShopAccess(c, car.ShopID) {
+				return
+			}
+			id := car.ID
 			if err := c.ShouldBindJSON(&car); err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
-			db.Save(&car)
+			car.ID = id
+			car.DeletedAt = gorm.DeletedAt{}
+			if !checkShopAccess(c, car.ShopID) {
+				return
+			}
+			if err := validateCarPowertrain(&car); err != nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+				return
+			}
+			if !checkCarVIN(c, db, &car) {
+				return
+			}
+			if err := db.Save(&car).Error; err != nil {
+				if isVINConflict(err) {
+					c.JSON(http.StatusConflict, gin.H{"error": vinTakenMessage})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при сохранении автомобиля"})
+				return
+			}
 			c.JSON(http.StatusOK, car)
 		})
 
-		adminRoutes.DELETE("/cars/:id", func(c *gin.Context) {
+		carRoutes.DELETE("/cars/:id", func(c *gin.Context) {
 			id := c.Param("id")
+			var car Car
+			if db.First(&car, id).Error == nil && !checkShopAccess(c, car.ShopID) {
+				return
+			}
 			db.Delete(&Car{}, id)
 			c.JSON(http.StatusOK, gin.H{"message": "Автомобиль удален"})
 		})
 
 		// создание автосалона
-		adminRoutes.POST("/shops", func(c *gin.Context) {
+		catalogRoutes.POST("/shops", func(c *gin.Context) {
 			var shop Shop
 			if err := c.ShouldBindJSON(&shop); err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -474,7 +714,7 @@ func main() {
 		})
 
 		// создание марки
-		adminRoutes.POST("/brands", func(c *gin.Context) {
+		catalogRoutes.POST("/brands", func(c *gin.Context) {
 			var brand CarBrand
 			if err := c.ShouldBindJSON(&brand); err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -484,8 +724,33 @@ func main() {
 			c.JSON(http.StatusCreated, brand)
 		})
 
+		// назначение профиля обслуживания марке
+		catalogRoutes.PUT("/brands/:id", func(c *gin.Context) {
+			var brand CarBrand
+			db.First(&brand, c.Param("id"))
+			if brand.ID == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Марка не найдена"})
+				return
+			}
+			id := brand.ID
+			if err := c.ShouldBindJSON(&brand); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if brand.ServiceProfileID != nil {
+				var profile ServiceProfile
+				if err := db.First(&profile, *brand.ServiceProfileID).Error; err != nil {
+					c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Профиль обслуживания не найден"})
+					return
+				}
+			}
+			brand.ID = id
+			db.Save(&brand)
+			c.JSON(http.StatusOK, brand)
+		})
+
 		// создание модели
-		adminRoutes.POST("/models", func(c *gin.Context) {
+		catalogRoutes.POST("/models", func(c *gin.Context) {
 			var model CarModel
 			if err := c.ShouldBindJSON(&model); err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -495,92 +760,247 @@ func main() {
 			c.JSON(http.StatusCreated, model)
 		})
 
+		catalogRoutes.PUT("/models/:id", func(c *gin.Context) {
+			var model CarModel
+			db.First(&model, c.Param("id"))
+			if model.ID == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Модель не найдена"})
+				return
+			}
+			id := model.ID
+			if err := c.ShouldBindJSON(&model); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if model.FuelConsumption < 0 {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Расход не может быть отрицательным"})
+				return
+			}
+			model.ID = id
+			db.Omit("Brand").Save(&model)
+			c.JSON(http.StatusOK, model)
+		})
+
 		// CRUD клиента
-		adminRoutes.POST("/customers", func(c *gin.Context) {
+		customerRoutes.POST("/customers", func(c *gin.Context) {
 			var customer Customer
 			if err := c.ShouldBindJSON(&customer); err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
+			customer.DeletedAt = gorm.DeletedAt{}
 			db.Create(&customer)
 			c.JSON(http.StatusCreated, customer)
 		})
 
-		adminRoutes.PUT("/customers/:id", func(c *gin.Context) {
+		customerRoutes.PUT("/customers/:id", func(c *gin.Context) {
 			var customer Customer
-			id := c.Param("id")
-			db.First(&customer, id)
+			db.First(&customer, c.Param("id"))
 			if customer.ID == 0 {
 				c.JSON(http.StatusNotFound, gin.H{"error": "Клиент не найден"})
 				return
 			}
+			id := customer.ID
 			if err := c.ShouldBindJSON(&customer); err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
+			customer.ID = id
+			customer.DeletedAt = gorm.DeletedAt{}
 			db.Save(&customer)
 			c.JSON(http.StatusOK, customer)
 		})
 
-		adminRoutes.DELETE("/customers/:id", func(c *gin.Context) {
+		customerRoutes.DELETE("/customers/:id", func(c *gin.Context) {
 			id := c.Param("id")
 			db.Delete(&Customer{}, id)
 			c.JSON(http.StatusOK, gin.H{"message": "Клиент удален"})
 		})
 
 		// CRUD сотрудника
-		adminRoutes.POST("/employees", func(c *gin.Context) {
+		employeeRoutes.POST("/employees", func(c *gin.Context) {
 			var employee Employee
 			if err := c.ShouldBindJSON(&employee); err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
+			employee.DeletedAt = gorm.DeletedAt{}
+			if !checkShopAccess(c, employee.ShopID) {
+				return
+			}
 			db.Create(&employee)
 			c.JSON(http.StatusCreated, employee)
 		})
 
-		adminRoutes.PUT("/employees/:id", func(c *gin.Context) {
+		employeeRoutes.PUT("/employees/:id", func(c *gin.Context) {
 			var employee Employee
-			id := c.Param("id")
-			db.First(&employee, id)
+			db.First(&employee, c.Param("id"))
 			if employee.ID == 0 {
 				c.JSON(http.StatusNotFound, gin.H{"error": "Сотрудник не найден"})
 				return
 			}
+			if !checkShopAccess(c, employee.ShopID) {
+				return
+			}
+			id := employee.ID
 			if err := c.ShouldBindJSON(&employee); err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
+			employee.ID = id
+			employee.DeletedAt = gorm.DeletedAt{}
+			if !checkShopAccess(c, employee.ShopID) {
+				return
+			}
 			db.Save(&employee)
 			c.JSON(http.StatusOK, employee)
 		})
 
-		adminRoutes.DELETE("/employees/:id", func(c *gin.Context) {
+		employeeRoutes.DELETE("/employees/:id", func(c *gin.Context) {
 			id := c.Param("id")
+			var employee Employee
+			if db.First(&employee, id).Error == nil && !checkShopAccess(c, employee.ShopID) {
+				return
+			}
 			db.Delete(&Employee{}, id)
 			c.JSON(http.StatusOK, gin.H{"message": "Сотрудник удален"})
 		})
 
+		// удаленные автомобили, покупатели и сотрудники: просмотр, восстановление, окончательное удаление
+		SetupSoftDeleteRoutes(carRoutes, customerRoutes, employeeRoutes, db)
+
 		// добавление продажи
-		adminRoutes.POST("/sales", func(c *gin.Context) {
+		saleRoutes.POST("/sales", func(c *gin.Context) {
 			var sale Sale
 			if err := c.ShouldBindJSON(&sale); err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
-			if sale.SaleDate.IsZero() {
-				sale.SaleDate = time.Now()
+			if !checkShopAccess(c, sale.ShopID) {
+				return
+			}
+			if err := createSale(db, &sale); err != nil {
+				respondSaleError(c, err)
+				return
 			}
-			db.Create(&sale)
-			db.Model(&Car{}).Where("id = ?", sale.CarID).Update("in_stock", false)
 			c.JSON(http.StatusCreated, sale)
 		})
+
+		// CRUD вариантов финансирования
+		financeRoutes.POST("/finance-options", func(c *gin.Context) {
+			var option FinanceOption
+			if err := c.ShouldBindJSON(&option); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err := validateFinanceOption(&option); err != nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+				return
+			}
+			if err := db.Create(&option).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при создании варианта финансирования"})
+				return
+			}
+			c.JSON(http.StatusCreated, option)
+		})
+
+		financeRoutes.PUT("/finance-options/:id", func(c *gin.Context) {
+			var option FinanceOption
+			db.First(&option, c.Param("id"))
+			if option.ID == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Вариант финансирования не найден"})
+				return
+			}
+			id := option.ID
+			if err := c.ShouldBindJSON(&option); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			option.ID = id
+			if err := validateFinanceOption(&option); err != nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+				return
+			}
+			db.Save(&option)
+			c.JSON(http.StatusOK, option)
+		})
+
+		financeRoutes.DELETE("/finance-options/:id", func(c *gin.Context) {
+			var option FinanceOption
+			id := c.Param("id")
+			if err := db.First(&option, id).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Вариант финансирования не найден"})
+				return
+			}
+			// сохраненные расчеты ссылаются на вариант, удалять его нельзя
+			var calculations int64
+			if err := db.Model(&CostCalculation{}).Where("finance_option_id = ?", option.ID).Count(&calculations).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки связанных записей"})
+				return
+			}
+			if calculations > 0 {
+				c.JSON(http.StatusConflict, gin.H{
+					"error":      "Вариант финансирования нельзя удалить: на него ссылаются сохраненные расчеты",
+					"references": gin.H{"calculations": calculations},
+				})
+				return
+			}
+			if err := db.Delete(&option).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при удалении варианта финансирования"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "Вариант финансирования удален"})
+		})
+
+		// тарифы калькулятора импорта
+		SetupTariffRoutes(financeRoutes, db)
+
+		// курсы валют для калькулятора импорта
+		SetupExchangeRateRoutes(financeRoutes, db)
+		SetupOwnershipRoutes(financeRoutes, db)
+
+		// роли и пользователи
+		SetupRoleRoutes(userAdminRoutes, db)
+
+		// обновление токенов, выход и отзыв сессий
+		SetupSessionRoutes(r, userAdminRoutes, db)
+
+		// журнал неудачных входов и снятие блокировок
+		SetupLoginGuardRoutes(userAdminRoutes, db)
+
+		// двухфакторная аутентификация и политика ее обязательности
+		SetupTwoFactorRoutes(r, userAdminRoutes, db)
+
+		// журнал изменений
+		SetupAuditRoutes(auditRoutes, db)
+
+		// отмена или возврат продажи
+		saleRoutes.POST("/sales/:id/cancel", requirePermission(PermSalesCancel), func(c *gin.Context) {
+			var req CancelSaleRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			var existing Sale
+			if db.First(&existing, c.Param("id")).Error == nil && !checkShopAccess(c, existing.ShopID) {
+				return
+			}
+			sale, err := cancelSale(db, c.Param("id"), req)
+			if err != nil {
+				respondSaleError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, sale)
+		})
 	}
 
 	// работа с избранными автомобилями
 	userRoutes := r.Group("/api/user")
 	userRoutes.Use(authMiddleware())
 	{
+		// личный кабинет покупателя: предпочтения, расчеты и покупки
+		SetupCustomerPortalRoutes(userRoutes, db)
+
 		// получение избранных автомобилей
 		userRoutes.GET("/favorites", func(c *gin.Context) {
 			username, _ := c.Get("username")
@@ -592,7 +1012,10 @@ func main() {
 			var result []Car = []Car{}
 			for _, fav := range favorites {
 				var car Car
-				db.Preload("Shop").Preload("Brand").Preload("Model").Where("id = ?", fav.CarID).First(&car)
+				// удаленные автомобили в избранном не показываем
+				if db.Preload("Shop").Preload("Brand").Preload("Model").Where("id = ?", fav.CarID).First(&car).Error != nil {
+					continue
+				}
 				result = append(result, car)
 			}
 			c.JSON(http.StatusOK, result)
@@ -674,18 +1097,17 @@ func main() {
 
 	// Дальше эндпоинты доступные без авторизации
 
-	// список всех автомобилей
-	r.GET("/api/cars", func(c *gin.Context) {
-		var cars []Car
-		db.Preload("Shop").Preload("Brand").Preload("Model").Where("in_stock = ?", true).Find(&cars)
-		c.JSON(http.StatusOK, cars)
-	})
+	// поиск и список автомобилей
+	SetupCarRoutes(r, db)
 
 	// информация об автомобиле
 	r.GET("/api/cars/:id", func(c *gin.Context) {
 		var car Car
 		id := c.Param("id")
-		db.Preload("Shop").Preload("Brand").Preload("Model").First(&car, id)
+		if err := db.Preload("Shop").Preload("Brand").Preload("Model").First(&car, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Автомобиль не найден"})
+			return
+		}
 		c.JSON(http.StatusOK, car)
 	})
 
@@ -719,14 +1141,14 @@ func main() {
 	})
 
 	// список всех клиентов
-	r.GET("/api/customers", func(c *gin.Context) {
+	r.GET("/api/customers", authMiddleware(), requirePermission(PermCustomersRead), func(c *gin.Context) {
 		var customers []Customer
 		db.Find(&customers)
-		c.JSON(http.StatusOK, customers)
+		c.JSON(http.StatusOK, customerViews(c, customers))
 	})
 
 	// получение покупателя по ID
-	r.GET("/api/customers/:id", func(c *gin.Context) {
+	r.GET("/api/customers/:id", authMiddleware(), requirePermission(PermCustomersRead), func(c *gin.Context) {
 		id := c.Param("id")
 		var customer Customer
 		result := db.First(&customer, id)
@@ -734,21 +1156,21 @@ func main() {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Покупатель не найден"})
 			return
 		}
-		c.JSON(http.StatusOK, customer)
+		c.JSON(http.StatusOK, customerViewOf(customer, canView(c, PermCustomersContacts)))
 	})
 
 	// список всех сотрудников
-	r.GET("/api/employees", func(c *gin.Context) {
+	r.GET("/api/employees", authMiddleware(), requirePermission(PermEmployeesRead), func(c *gin.Context) {
 		var employees []Employee
-		db.Preload("Shop").Find(&employees)
-		c.JSON(http.StatusOK, employees)
+		scopeToShop(c, db.Preload("Shop"), "shop_id").Find(&employees)
+		c.JSON(http.StatusOK, employeeViews(c, employees))
 	})
 
 	// список всех продаж
-	r.GET("/api/sales", func(c *gin.Context) {
+	r.GET("/api/sales", authMiddleware(), requirePermission(PermSalesRead), func(c *gin.Context) {
 		var sales []Sale
-		db.Preload("Car.Brand").Preload("Car.Model").Preload("Customer").Preload("Shop").Preload("Employee").Order("sale_date DESC").Find(&sales)
-		c.JSON(http.StatusOK, sales)
+		scopeToShop(c, salesQuery(db), "shop_id").Order("sale_date DESC").Find(&sales)
+		c.JSON(http.StatusOK, saleViews(c, sales))
 	})
 
 	// список вариантов финансирования
@@ -758,20 +1180,14 @@ func main() {
 		c.JSON(http.StatusOK, options)
 	})
 
-	// автомобили с низким пробегом
-	r.GET("/api/cars/low-mileage", func(c *gin.Context) {
-		var cars []Car
-		db.Preload("Shop").Preload("Brand").Preload("Model").
-			Where("condition = 'used' AND mileage < 30000 AND in_stock = ?", true).Find(&cars)
-		c.JSON(http.StatusOK, cars)
-	})
-
-	// новые автомобили
-	r.GET("/api/cars/new", func(c *gin.Context) {
-		var cars []Car
-		db.Preload("Shop").Preload("Brand").Preload("Model").
-			Where("condition = 'new' AND in_stock = ?", true).Find(&cars)
-		c.JSON(http.StatusOK, cars)
+	// вариант финансирования по ID
+	r.GET("/api/finance-options/:id", func(c *gin.Context) {
+		var option FinanceOption
+		if err := db.First(&option, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Вариант финансирования не найден"})
+			return
+		}
+		c.JSON(http.StatusOK, option)
 	})
 
 	// самый дорогой автомобиль
@@ -783,7 +1199,7 @@ func main() {
 	})
 
 	// подбор клиентов для автомобиля
-	r.GET("/api/customers/match-car/:carId", func(c *gin.Context) {
+	r.GET("/api/customers/match-car/:carId", authMiddleware(), requirePermission(PermCustomersRead), func(c *gin.Context) {
 		carID := c.Param("carId")
 		var car Car
 		db.Preload("Brand").Preload("Model").First(&car, carID)
@@ -812,20 +1228,25 @@ func main() {
 		}
 
 		query.Find(&matchingCustomers)
-		c.JSON(http.StatusOK, matchingCustomers)
+		c.JSON(http.StatusOK, customerViews(c, matchingCustomers))
 	})
 
 	// статистика продаж по автосалонам
-	r.GET("/api/stats/shop-sales", func(c *gin.Context) {
+	r.GET("/api/stats/shop-sales", authMiddleware(), requirePermission(PermStatsRead), func(c *gin.Context) {
 		var result []struct {
 			ShopID       uint   `json:"shopId"`
 			ShopName     string `json:"shopName"`
 			SalesCount   int    `json:"salesCount"`
-			TotalRevenue int    `json:"totalRevenue"`
+			TotalRevenue Money  `json:"totalRevenue"`
 		}
 
-		db.Table("sales").
-			Select("sales.shop_id, shops.name as shop_name, COUNT(*) as sales_count, SUM(sales.sale_price) as total_revenue").
+		// отмененные продажи не дают выручки, по возвратам учитывается удержанная сумма
+		scopeToShop(c, db.Table("sales"), "sales.shop_id").
+			Select("sales.shop_id, shops.name as shop_name, "+
+				"SUM(CASE WHEN sales.status = ? THEN 1 ELSE 0 END) as sales_count, "+
+				sqlMoneySum("CASE WHEN sales.status = ? THEN sales.sale_price "+
+					"WHEN sales.status = ? THEN sales.sale_price - sales.refund_amount ELSE 0 END")+" as total_revenue",
+				SaleStatusCompleted, SaleStatusCompleted, SaleStatusReturned).
 			Joins("JOIN shops ON shops.id = sales.shop_id").
 			Group("sales.shop_id").
 			Scan(&result)
@@ -835,38 +1256,84 @@ func main() {
 
 	// анализ рынка
 	r.GET("/api/market/ratio", func(c *gin.Context) {
-		var totalBudget int64
-		var totalCarPrice int64
-		db.Model(&Customer{}).Select("coalesce(sum(max_price), 0)").Row().Scan(&totalBudget)
-		db.Model(&Car{}).Where("in_stock = ?", true).Select("coalesce(sum(price), 0)").Row().Scan(&totalCarPrice)
+		var totalBudget Money
+		var totalCarPrice Money
+		db.Model(&Customer{}).Select(sqlMoneySum("max_price")).Row().Scan(&totalBudget)
+		db.Model(&Car{}).Where("in_stock = ?", true).Select(sqlMoneySum("price")).Row().Scan(&totalCarPrice)
 		c.JSON(http.StatusOK, gin.H{
 			"totalCustomerBudget": totalBudget,
 			"totalCarPrice":       totalCarPrice,
-			"ratio":               float64(totalBudget) / float64(totalCarPrice),
+			"ratio":               totalBudget.Float() / totalCarPrice.Float(),
 		})
 	})
 
 	r.Run(":8080")
 }
 
-// создание базового админа
-func createDefaultAdmin(db *gorm.DB) error {
-	var adminCount int64
-	db.Model(&User{}).Where("is_admin = ?", true).Count(&adminCount)
-	if adminCount == 0 {
-		passwordHash, err := bcrypt.GenerateFromPassword([]byte("admin"), bcrypt.DefaultCost)
-		if err != nil {
+// известный пароль по умолчанию из старых версий
+const legacyDefaultPassword = "admin"
+
+// вне режима dev сотрудник с паролем по умолчанию обязан сменить его при входе
+func requireDefaultPasswordChange(db *gorm.DB, cfg AuthConfig) error {
+	if cfg.isDev() {
+		return nil
+	}
+	var users []User
+	if err := db.Where("role <> ? AND must_change_password = ?", RoleCustomer, false).Find(&users).Error; err != nil {
+		return err
+	}
+	for _, user := range users {
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(legacyDefaultPassword)) != nil {
+			continue
+		}
+		if err := db.Model(&user).Update("must_change_password", true).Error; err != nil {
 			return err
 		}
+		log.Printf("У пользователя %s пароль по умолчанию, при входе потребуется его сменить", user.Username)
+	}
+	return nil
+}
 
-		admin := User{
-			Username:     "admin",
-			PasswordHash: string(passwordHash),
-			IsAdmin:      true,
-			CreatedAt:    time.Now(),
+// создание владельца при первом запуске: пароль берется из настроек
+// или генерируется одноразовый и выводится в лог
+func createDefaultAdmin(db *gorm.DB, cfg AuthConfig) error {
+	var adminCount int64
+	db.Model(&User{}).Where("role = ?", RoleOwner).Count(&adminCount)
+	if adminCount > 0 {
+		return nil
+	}
+
+	password := cfg.AdminPassword
+	generated := password == ""
+	if generated {
+		var err error
+		if password, err = randomToken(8); err != nil {
+			return err
+		}
+	} else if !cfg.isDev() {
+		if err := passwordPolicy.validate(password, cfg.AdminUsername, ""); err != nil {
+			return fmt.Errorf("пароль администратора ADMIN_PASSWORD: %w", err)
 		}
-		result := db.Create(&admin)
-		return result.Error
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	admin := User{
+		Username:           cfg.AdminUsername,
+		PasswordHash:       string(passwordHash),
+		IsAdmin:            true,
+		Role:               RoleOwner,
+		MustChangePassword: generated,
+		CreatedAt:          time.Now(),
+	}
+	if err := db.Create(&admin).Error; err != nil {
+		return err
+	}
+	if generated {
+		log.Printf("Создан владелец %s с одноразовым паролем %s, смените пароль после первого входа", admin.Username, password)
 	}
 	return nil
 }
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// Денежная сумма в копейках.
+// В JSON передается строкой с двумя знаками после точки ("1234.50"), на входе принимается и число.
+// В базе хранится в рублях в тех же столбцах, что и прежние целые цены.
+type Money int64
+
+const moneyScale = 100
+
+// сумма в рублях
+func rub(rubles int64) Money {
+	return Money(rubles * moneyScale)
+}
+
+// округление до копейки по банковскому правилу: половина копейки округляется к четному
+func roundRat(r *big.Rat) Money {
+	num := new(big.Int).Mul(r.Num(), big.NewInt(moneyScale))
+	den := r.Denom()
+	q, m := new(big.Int).DivMod(num, den, new(big.Int))
+	switch new(big.Int).Lsh(m, 1).Cmp(den) {
+	case 1:
+		q.Add(q, big.NewInt(1))
+	case 0:
+		if q.Bit(0) == 1 {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return Money(q.Int64())
+}
+
+// точное десятичное значение числа по его кратчайшей записи
+func decimalRat(f float64) *big.Rat {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	return r
+}
+
+func (m Money) rat() *big.Rat {
+	return big.NewRat(int64(m), moneyScale)
+}
+
+// сумма из результата вычислений с плавающей точкой
+func moneyFromFloat(f float64) Money {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	return roundRat(decimalRat(f))
+}
+
+// разбор десятичной записи суммы, лишние знаки округляются до копейки
+func parseMoney(s string) (Money, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("некорректная сумма: %q", s)
+	}
+	return roundRat(r), nil
+}
+
+// умножение на коэффициент с округлением до копейки
+func (m Money) Mul(factor float64) Money {
+	return roundRat(new(big.Rat).Mul(m.rat(), decimalRat(factor)))
+}
+
+// деление на целое число с округлением до копейки
+func (m Money) Div(n int) Money {
+	return roundRat(new(big.Rat).Quo(m.rat(), big.NewRat(int64(n), 1)))
+}
+
+// деление на коэффициент с округлением до копейки
+func (m Money) Quo(divisor float64) Money {
+	return roundRat(new(big.Rat).Quo(m.rat(), decimalRat(divisor)))
+}
+
+// умножение на целое число без округления
+func (m Money) Times(n int) Money {
+	return m * Money(n)
+}
+
+func (m Money) Float() float64 {
+	return float64(m) / moneyScale
+}
+
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/moneyScale, v%moneyScale)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + m.String() + `"`), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.Trim(data, `"`)
+	if len(data) == 0 || string(data) == "null" {
+		*m = 0
+		return nil
+	}
+	v, err := parseMoney(string(data))
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// sqlite хранит целые рубли как INTEGER, суммы с копейками как REAL;
+// при чтении значение округляется до копейки
+func (Money) GormDataType() string {
+	return "integer"
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = rub(v)
+	case float64:
+		*m = moneyFromFloat(v)
+	case []byte:
+		return m.UnmarshalJSON(v)
+	case string:
+		return m.UnmarshalJSON([]byte(v))
+	default:
+		return fmt.Errorf("неподдерживаемый тип суммы: %T", value)
+	}
+	return nil
+}
+
+// сумма столбца в SQL без накопления ошибки: складываются копейки, результат в рублях
+func sqlMoneySum(expr string) string {
+	return "COALESCE(SUM(CAST(ROUND((" + expr + ") * 100) AS INTEGER)), 0) / 100.0"
+}
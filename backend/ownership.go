@@ -0,0 +1,325 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const defaultTaxRegion = "default"
+
+// Профиль стоимости обслуживания марки
+type ServiceProfile struct {
+	ID   uint   `json:"id" gorm:"primaryKey"`
+	Name string `json:"name"`
+	// доля цены автомобиля в год
+	YearlyRate float64 `json:"yearlyRate"`
+	// рост стоимости обслуживания за каждый год возраста автомобиля, доля
+	AgeIncrease float64 `json:"ageIncrease"`
+}
+
+// профиль для марок без назначенного профиля
+var standardServiceProfile = ServiceProfile{Name: "Стандартный", YearlyRate: 0.03}
+
+// Модель ставок транспортного налога региона
+type TransportTaxRegion struct {
+	ID   uint   `json:"id" gorm:"primaryKey"`
+	Code string `json:"code" gorm:"uniqueIndex"`
+	Name string `json:"name"`
+	// ставка в рублях за л.с. по ступеням мощности в л.с.
+	Brackets       []TariffBracket `json:"brackets" gorm:"serializer:json"`
+	ElectricExempt bool            `json:"electricExempt"`
+}
+
+// годовая доля потери стоимости по возрасту автомобиля
+var depreciationByAge = []TariffBracket{
+	{Max: floatPtr(1), Value: 0.15},
+	{Max: floatPtr(3), Value: 0.10},
+	{Max: floatPtr(5), Value: 0.08},
+	{Value: 0.06},
+}
+
+func defaultTransportTaxRegion() TransportTaxRegion {
+	return TransportTaxRegion{
+		Code: defaultTaxRegion,
+		Name: "Москва",
+		Brackets: []TariffBracket{
+			{Max: floatPtr(100), Value: 12},
+			{Max: floatPtr(125), Value: 25},
+			{Max: floatPtr(150), Value: 35},
+			{Max: floatPtr(175), Value: 45},
+			{Max: floatPtr(200), Value: 50},
+			{Max: floatPtr(225), Value: 65},
+			{Max: floatPtr(250), Value: 75},
+			{Value: 150},
+		},
+		ElectricExempt: true,
+	}
+}
+
+func validateServiceProfile(profile *ServiceProfile) error {
+	if profile.Name == "" {
+		return errors.New("Название профиля обязательно")
+	}
+	if profile.YearlyRate < 0 || profile.YearlyRate >= 1 {
+		return errors.New("yearlyRate: доля цены в год задается от 0 до 1")
+	}
+	if profile.AgeIncrease < 0 {
+		return errors.New("ageIncrease: рост стоимости не может быть отрицательным")
+	}
+	return nil
+}
+
+func validateTransportTaxRegion(region *TransportTaxRegion) error {
+	if region.Code == "" {
+		return errors.New("Код региона обязателен")
+	}
+	return validateBrackets("brackets", region.Brackets)
+}
+
+// создание профилей обслуживания и налоговой таблицы по умолчанию;
+// марки с ID до 5 считались премиальными, они получают профиль 5%
+func createDefaultOwnershipData(db *gorm.DB) error {
+	var count int64
+	db.Model(&ServiceProfile{}).Count(&count)
+	if count == 0 {
+		standard := standardServiceProfile
+		premium := ServiceProfile{Name: "Премиум", YearlyRate: 0.05}
+		if err := db.Create(&standard).Error; err != nil {
+			return err
+		}
+		if err := db.Create(&premium).Error; err != nil {
+			return err
+		}
+		db.Model(&CarBrand{}).Where("service_profile_id IS NULL AND id <= ?", 5).Update("service_profile_id", premium.ID)
+		db.Model(&CarBrand{}).Where("service_profile_id IS NULL").Update("service_profile_id", standard.ID)
+	}
+
+	db.Model(&TransportTaxRegion{}).Count(&count)
+	if count == 0 {
+		region := defaultTransportTaxRegion()
+		return db.Create(&region).Error
+	}
+	return nil
+}
+
+// расход на 100 км: у автомобиля, затем у модели, затем по типу силовой установки
+func carConsumption(car Car, profile energyProfile) float64 {
+	if car.FuelConsumption > 0 {
+		return car.FuelConsumption
+	}
+	if car.Model.FuelConsumption > 0 {
+		return car.Model.FuelConsumption
+	}
+	return profile.ConsumptionPer
+}
+
+// мощность для транспортного налога в л.с.
+func carTaxPower(car Car) float64 {
+	if car.EnginePower > 0 {
+		return float64(car.EnginePower)
+	}
+	return math.Round(float64(car.ElectricPower) * kwToHP)
+}
+
+// транспортный налог за год
+func calculateTransportTax(region TransportTaxRegion, car Car) Money {
+	if region.ElectricExempt && car.FuelType == FuelElectric {
+		return 0
+	}
+	power := carTaxPower(car)
+	return moneyFromFloat(bracketValue(region.Brackets, power)).Mul(power)
+}
+
+// расчет стоимости владения по годам, суммы каждого года округляются до копейки
+func calculateTotalCost(car Car, req TotalCostRequest, profile ServiceProfile, region TransportTaxRegion, asOf time.Time) (TotalCostResponse, error) {
+	fuelType, err := normalizeFuelType(car.FuelType)
+	if err != nil {
+		return TotalCostResponse{}, err
+	}
+	car.FuelType = fuelType
+	energy := defaultEnergyProfiles[fuelType]
+	if req.EnergyPrice > 0 {
+		energy.Price = req.EnergyPrice
+	}
+	consumption := carConsumption(car, energy)
+
+	price := car.Price
+	result := TotalCostResponse{
+		InitialPrice:     price,
+		YearsOfOwnership: float64(req.LoanTerm) / 12,
+		FuelType:         fuelType,
+		EnergyUnit:       energy.Unit,
+		EnergyPrice:      energy.Price,
+		Consumption:      consumption,
+		ServiceProfile:   profile.Name,
+		Region:           region.Code,
+		AsOf:             asOf.Format(tariffDateLayout),
+		Years:            []TotalCostYear{},
+	}
+
+	age := carAge(car.Year, asOf)
+	value := price
+	for months, year := req.LoanTerm, 1; months > 0; months, year = months-12, year+1 {
+		yearMonths := min(months, 12)
+		share := float64(yearMonths) / 12
+		energyUsed := consumption / 100 * float64(req.YearlyMileage) * share
+		item := TotalCostYear{
+			Year:          year,
+			Months:        yearMonths,
+			FuelCost:      energy.Price.Mul(energyUsed),
+			ServiceCost:   price.Mul(profile.YearlyRate * (1 + profile.AgeIncrease*float64(age))).Times(yearMonths).Div(12),
+			TaxCost:       calculateTransportTax(region, car).Times(yearMonths).Div(12),
+			InsuranceCost: price.Mul(0.05).Times(yearMonths).Div(12),
+			Depreciation:  value.Mul(bracketValue(depreciationByAge, float64(age))).Times(yearMonths).Div(12),
+		}
+		value -= item.Depreciation
+		item.ValueAtEnd = value
+		item.TotalCost = item.FuelCost + item.ServiceCost + item.TaxCost + item.InsuranceCost
+
+		result.EnergyConsumed += energyUsed
+		result.FuelCost += item.FuelCost
+		result.ServiceCost += item.ServiceCost
+		result.TaxCost += item.TaxCost
+		result.InsuranceCost += item.InsuranceCost
+		result.Depreciation += item.Depreciation
+		result.Years = append(result.Years, item)
+		age++
+	}
+
+	result.TotalCost = price + result.FuelCost + result.ServiceCost + result.TaxCost + result.InsuranceCost
+	result.ResaleValue = value
+	result.NetCost = result.TotalCost - result.ResaleValue
+	return result, nil
+}
+
+func SetupOwnershipRoutes(adminRoutes *gin.RouterGroup, db *gorm.DB) {
+
+	// профили обслуживания
+	adminRoutes.GET("/service-profiles", func(c *gin.Context) {
+		var profiles []ServiceProfile
+		db.Order("id").Find(&profiles)
+		c.JSON(http.StatusOK, profiles)
+	})
+
+	adminRoutes.POST("/service-profiles", func(c *gin.Context) {
+		var profile ServiceProfile
+		if err := c.ShouldBindJSON(&profile); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateServiceProfile(&profile); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		profile.ID = 0
+		if err := db.Create(&profile).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при создании профиля обслуживания"})
+			return
+		}
+		c.JSON(http.StatusCreated, profile)
+	})
+
+	adminRoutes.PUT("/service-profiles/:id", func(c *gin.Context) {
+		var profile ServiceProfile
+		if err := db.First(&profile, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Профиль обслуживания не найден"})
+			return
+		}
+		id := profile.ID
+		if err := c.ShouldBindJSON(&profile); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateServiceProfile(&profile); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		profile.ID = id
+		if err := db.Save(&profile).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при сохранении профиля обслуживания"})
+			return
+		}
+		c.JSON(http.StatusOK, profile)
+	})
+
+	adminRoutes.DELETE("/service-profiles/:id", func(c *gin.Context) {
+		var count int64
+		db.Model(&CarBrand{}).Where("service_profile_id = ?", c.Param("id")).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Профиль назначен маркам"})
+			return
+		}
+		db.Delete(&ServiceProfile{}, c.Param("id"))
+		c.JSON(http.StatusOK, gin.H{"message": "Профиль обслуживания удален"})
+	})
+
+	// ставки транспортного налога по регионам
+	adminRoutes.GET("/transport-tax", func(c *gin.Context) {
+		var regions []TransportTaxRegion
+		db.Order("code").Find(&regions)
+		c.JSON(http.StatusOK, regions)
+	})
+
+	adminRoutes.POST("/transport-tax", func(c *gin.Context) {
+		var region TransportTaxRegion
+		if err := c.ShouldBindJSON(&region); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateTransportTaxRegion(&region); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		var count int64
+		db.Model(&TransportTaxRegion{}).Where("code = ?", region.Code).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Регион с таким кодом уже существует"})
+			return
+		}
+		region.ID = 0
+		if err := db.Create(&region).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при создании региона"})
+			return
+		}
+		c.JSON(http.StatusCreated, region)
+	})
+
+	adminRoutes.PUT("/transport-tax/:id", func(c *gin.Context) {
+		var region TransportTaxRegion
+		if err := db.First(&region, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Регион не найден"})
+			return
+		}
+		id := region.ID
+		if err := c.ShouldBindJSON(&region); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateTransportTaxRegion(&region); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		var count int64
+		db.Model(&TransportTaxRegion{}).Where("code = ? AND id <> ?", region.Code, id).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Регион с таким кодом уже существует"})
+			return
+		}
+		region.ID = id
+		if err := db.Save(&region).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при сохранении региона"})
+			return
+		}
+		c.JSON(http.StatusOK, region)
+	})
+
+	adminRoutes.DELETE("/transport-tax/:id", func(c *gin.Context) {
+		db.Delete(&TransportTaxRegion{}, c.Param("id"))
+		c.JSON(http.StatusOK, gin.H{"message": "Регион удален"})
+	})
+}
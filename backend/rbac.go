@@ -0,0 +1,269 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// роли пользователей
+const (
+	RoleOwner          = "owner"
+	RoleShopManager    = "shop_manager"
+	RoleSalesperson    = "salesperson"
+	RoleFinanceOfficer = "finance_officer"
+	RoleAnalyst        = "analyst"
+	RoleCustomer       = "customer"
+)
+
+// права на группы маршрутов
+const (
+	PermCatalogWrite      = "catalog:write"
+	PermCarsWrite         = "cars:write"
+	PermCustomersRead     = "customers:read"
+	PermCustomersWrite    = "customers:write"
+	PermCustomersContacts = "customers:contacts"
+	PermEmployeesRead     = "employees:read"
+	PermEmployeesWrite    = "employees:write"
+	PermEmployeesSalary   = "employees:salary"
+	PermSalesRead         = "sales:read"
+	PermSalesWrite        = "sales:write"
+	PermSalesCancel       = "sales:cancel"
+	PermFinanceWrite      = "finance:write"
+	PermCalculationsRead  = "calculations:read"
+	PermStatsRead         = "stats:read"
+	PermUsersManage       = "users:manage"
+	PermAuditRead         = "audit:read"
+)
+
+var allPermissions = []string{
+	PermCatalogWrite, PermCarsWrite,
+	PermCustomersRead, PermCustomersWrite, PermCustomersContacts,
+	PermEmployeesRead, PermEmployeesWrite, PermEmployeesSalary,
+	PermSalesRead, PermSalesWrite, PermSalesCancel,
+	PermFinanceWrite, PermCalculationsRead, PermStatsRead,
+	PermUsersManage, PermAuditRead,
+}
+
+// права ролей
+var rolePermissions = map[string][]string{
+	RoleOwner: allPermissions,
+	RoleShopManager: {
+		PermCarsWrite,
+		PermCustomersRead, PermCustomersWrite, PermCustomersContacts,
+		PermEmployeesRead, PermEmployeesWrite, PermEmployeesSalary,
+		PermSalesRead, PermSalesWrite, PermSalesCancel,
+		PermCalculationsRead, PermStatsRead, PermAuditRead,
+	},
+	RoleSalesperson: {
+		PermCustomersRead, PermCustomersWrite, PermCustomersContacts,
+		PermEmployeesRead,
+		PermSalesRead, PermSalesWrite,
+		PermCalculationsRead,
+	},
+	RoleFinanceOfficer: {
+		PermCustomersRead,
+		PermSalesRead,
+		PermFinanceWrite, PermCalculationsRead, PermStatsRead,
+	},
+	RoleAnalyst: {
+		PermCustomersRead, PermEmployeesRead, PermSalesRead,
+		PermCalculationsRead, PermStatsRead,
+	},
+	RoleCustomer: {},
+}
+
+// роли, которые видят и меняют только данные своего автосалона
+var shopScopedRoles = map[string]bool{
+	RoleShopManager: true,
+	RoleSalesperson: true,
+}
+
+func roleHasPermission(role, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// роль для пользователей, созданных до появления ролей
+func userRole(user User) string {
+	if user.Role != "" {
+		return user.Role
+	}
+	if user.IsAdmin {
+		return RoleOwner
+	}
+	return RoleCustomer
+}
+
+// мидлварь проверки права роли
+func requirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		if !roleHasPermission(role, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав", "permission": permission})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// автосалон пользователя, если его роль ограничена одним салоном
+func shopScope(c *gin.Context) (uint, bool) {
+	if !shopScopedRoles[c.GetString("role")] {
+		return 0, false
+	}
+	shopID, _ := c.Get("shopId")
+	id, _ := shopID.(uint)
+	return id, true
+}
+
+// проверка доступа к данным автосалона, при отказе отправляет 403
+func checkShopAccess(c *gin.Context, shopID uint) bool {
+	if scopeID, scoped := shopScope(c); scoped && scopeID != shopID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Нет доступа к данным другого автосалона"})
+		return false
+	}
+	return true
+}
+
+// ограничение выборки автосалоном пользователя
+func scopeToShop(c *gin.Context, query *gorm.DB, column string) *gorm.DB {
+	if shopID, scoped := shopScope(c); scoped {
+		return query.Where(column+" = ?", shopID)
+	}
+	return query
+}
+
+// назначение роли пользователю
+type RoleAssignment struct {
+	Role   string `json:"role" binding:"required"`
+	ShopID *uint  `json:"shopId"`
+}
+
+// пользователь без пароля для списка пользователей
+type UserView struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	FullName string `json:"fullName"`
+	Role     string `json:"role"`
+	ShopID   *uint  `json:"shopId"`
+}
+
+func userViewOf(user User) UserView {
+	return UserView{
+		ID:       user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		FullName: user.FullName,
+		Role:     userRole(user),
+		ShopID:   user.ShopID,
+	}
+}
+
+// перевод администраторов, созданных до появления ролей, в роль владельца;
+// пароль они обязаны сменить: старая база поставлялась с паролем по умолчанию
+func migrateAdminRoles(db *gorm.DB) error {
+	return db.Model(&User{}).
+		Where("is_admin = ? AND (role = ? OR role = '' OR role IS NULL)", true, RoleCustomer).
+		Updates(map[string]interface{}{"role": RoleOwner, "must_change_password": true}).Error
+}
+
+func SetupRoleRoutes(userAdminRoutes *gin.RouterGroup, db *gorm.DB) {
+
+	// роли и их права
+	userAdminRoutes.GET("/roles", func(c *gin.Context) {
+		roles := make([]string, 0, len(rolePermissions))
+		for role := range rolePermissions {
+			roles = append(roles, role)
+		}
+		sort.Strings(roles)
+
+		result := make([]gin.H, 0, len(roles))
+		for _, role := range roles {
+			result = append(result, gin.H{
+				"role":        role,
+				"permissions": rolePermissions[role],
+				"shopScoped":  shopScopedRoles[role],
+			})
+		}
+		c.JSON(http.StatusOK, result)
+	})
+
+	// пользователи с ролями
+	userAdminRoutes.GET("/users", func(c *gin.Context) {
+		query := db.Order("id")
+		if role := c.Query("role"); role != "" {
+			query = query.Where("role = ?", role)
+		}
+		var users []User
+		query.Find(&users)
+
+		result := make([]UserView, 0, len(users))
+		for _, user := range users {
+			result = append(result, userViewOf(user))
+		}
+		c.JSON(http.StatusOK, result)
+	})
+
+	// назначение роли
+	userAdminRoutes.PUT("/users/:id/role", func(c *gin.Context) {
+		var req RoleAssignment
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if _, ok := rolePermissions[req.Role]; !ok {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Неизвестная роль: " + req.Role})
+			return
+		}
+		if shopScopedRoles[req.Role] {
+			if req.ShopID == nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Для роли " + req.Role + " нужен автосалон shopId"})
+				return
+			}
+			var shop Shop
+			if err := db.First(&shop, *req.ShopID).Error; err != nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Автосалон не найден"})
+				return
+			}
+		} else {
+			req.ShopID = nil
+		}
+
+		var user User
+		if err := db.First(&user, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+			return
+		}
+
+		// в системе должен остаться хотя бы один владелец
+		if userRole(user) == RoleOwner && req.Role != RoleOwner {
+			var owners int64
+			db.Model(&User{}).Where("role = ?", RoleOwner).Count(&owners)
+			if owners <= 1 {
+				c.JSON(http.StatusConflict, gin.H{"error": "Нельзя снять роль с последнего владельца"})
+				return
+			}
+		}
+
+		user.Role = req.Role
+		user.ShopID = req.ShopID
+		user.IsAdmin = req.Role != RoleCustomer
+		// прежние access-токены с другой ролью перестают действовать,
+		// новые выдаются с новой ролью при обновлении по refresh-токену
+		user.TokenVersion++
+		if err := db.Model(&user).Select("role", "shop_id", "is_admin", "token_version").Updates(&user).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при сохранении роли"})
+			return
+		}
+		c.JSON(http.StatusOK, userViewOf(user))
+	})
+}
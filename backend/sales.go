@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// статус клиента после покупки; до покупки статус пустой
+const (
+	CustomerStatusNone      = ""
+	CustomerStatusPurchased = "purchased"
+)
+
+// статусы продажи
+const (
+	SaleStatusCompleted = "completed"
+	SaleStatusCancelled = "cancelled"
+	SaleStatusReturned  = "returned"
+)
+
+// отмена или возврат продажи
+type CancelSaleRequest struct {
+	Type         string `json:"type" binding:"required,oneof=cancel return"`
+	Reason       string `json:"reason" binding:"required"`
+	RefundAmount *Money `json:"refundAmount" binding:"required"`
+	Inspection   bool   `json:"inspection"`
+}
+
+// ошибка оформления продажи с HTTP-статусом для ответа
+type SaleError struct {
+	Status  int
+	Message string
+}
+
+func (e *SaleError) Error() string {
+	return e.Message
+}
+
+func saleConflict(message string) error {
+	return &SaleError{Status: http.StatusConflict, Message: message}
+}
+
+func saleUnprocessable(message string) error {
+	return &SaleError{Status: http.StatusUnprocessableEntity, Message: message}
+}
+
+// продажи со связанными записями, в том числе удаленными автомобилями, покупателями и сотрудниками
+func salesQuery(db *gorm.DB) *gorm.DB {
+	return db.Preload("Car", withDeleted).Preload("Car.Brand").Preload("Car.Model").
+		Preload("Customer", withDeleted).Preload("Shop").Preload("Employee", withDeleted)
+}
+
+// оформление продажи в одной транзакции
+func createSale(db *gorm.DB, sale *Sale) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var car Car
+		if err := tx.First(&car, sale.CarID).Error; err != nil {
+			return saleUnprocessable("Автомобиль не найден")
+		}
+		var customer Customer
+		if err := tx.First(&customer, sale.CustomerID).Error; err != nil {
+			return saleUnprocessable("Покупатель не найден")
+		}
+		var shop Shop
+		if err := tx.First(&shop, sale.ShopID).Error; err != nil {
+			return saleUnprocessable("Автосалон не найден")
+		}
+		var employee Employee
+		if err := tx.First(&employee, sale.EmployeeID).Error; err != nil {
+			return saleUnprocessable("Сотрудник не найден")
+		}
+
+		if car.ShopID != sale.ShopID {
+			return saleUnprocessable("Автомобиль не принадлежит указанному автосалону")
+		}
+		if employee.ShopID != sale.ShopID {
+			return saleUnprocessable("Сотрудник не работает в указанном автосалоне")
+		}
+		if sale.SalePrice <= 0 {
+			return saleUnprocessable("Цена продажи должна быть больше нуля")
+		}
+
+		var soldCount int64
+		if err := tx.Model(&Sale{}).Where("car_id = ? AND status = ?", sale.CarID, SaleStatusCompleted).
+			Count(&soldCount).Error; err != nil {
+			return err
+		}
+		if soldCount > 0 {
+			return saleConflict("Автомобиль уже продан")
+		}
+
+		// снимаем автомобиль с продажи только если он еще в наличии,
+		// так параллельная продажа того же автомобиля не пройдет
+		result := tx.Model(&Car{}).Where("id = ? AND in_stock = ?", sale.CarID, true).Update("in_stock", false)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return saleConflict("Автомобиля нет в наличии")
+		}
+
+		if sale.SaleDate.IsZero() {
+			sale.SaleDate = time.Now()
+		}
+		sale.Status = SaleStatusCompleted
+		sale.CancelReason = ""
+		sale.RefundAmount = 0
+		sale.CancelledAt = nil
+		if err := tx.Create(sale).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&customer).Updates(map[string]interface{}{
+			"status":       CustomerStatusPurchased,
+			"last_contact": sale.SaleDate,
+		}).Error
+	})
+}
+
+// отмена или возврат продажи: строка продажи сохраняется со статусом,
+// автомобиль возвращается в наличие или отправляется на осмотр
+func cancelSale(db *gorm.DB, saleID string, req CancelSaleRequest) (Sale, error) {
+	var sale Sale
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&sale, saleID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &SaleError{Status: http.StatusNotFound, Message: "Продажа не найдена"}
+			}
+			return err
+		}
+		if sale.Status != SaleStatusCompleted {
+			return saleConflict("Продажа уже отменена")
+		}
+		if *req.RefundAmount < 0 || *req.RefundAmount > sale.SalePrice {
+			return saleUnprocessable("Сумма возврата должна быть от 0 до цены продажи")
+		}
+
+		now := time.Now()
+		sale.Status = SaleStatusCancelled
+		if req.Type == "return" {
+			sale.Status = SaleStatusReturned
+		}
+		sale.CancelReason = req.Reason
+		sale.RefundAmount = *req.RefundAmount
+		sale.CancelledAt = &now
+
+		result := tx.Model(&Sale{}).Where("id = ? AND status = ?", sale.ID, SaleStatusCompleted).
+			Updates(map[string]interface{}{
+				"status":        sale.Status,
+				"cancel_reason": sale.CancelReason,
+				"refund_amount": sale.RefundAmount,
+				"cancelled_at":  sale.CancelledAt,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return saleConflict("Продажа уже отменена")
+		}
+
+		carUpdates := map[string]interface{}{"in_stock": true, "on_inspection": false}
+		if req.Type == "return" && req.Inspection {
+			carUpdates = map[string]interface{}{"in_stock": false, "on_inspection": true}
+		}
+		if err := tx.Model(&Car{}).Where("id = ?", sale.CarID).Updates(carUpdates).Error; err != nil {
+			return err
+		}
+
+		// отмена - последний контакт с клиентом
+		if err := tx.Unscoped().Model(&Customer{}).Where("id = ?", sale.CustomerID).Update("last_contact", now).Error; err != nil {
+			return err
+		}
+		// статус покупателя снимаем, если других завершенных покупок у него нет
+		var purchases int64
+		if err := tx.Model(&Sale{}).Where("customer_id = ? AND status = ?", sale.CustomerID, SaleStatusCompleted).
+			Count(&purchases).Error; err != nil {
+			return err
+		}
+		if purchases > 0 {
+			return nil
+		}
+		return tx.Unscoped().Model(&Customer{}).Where("id = ? AND status = ?", sale.CustomerID, CustomerStatusPurchased).
+			Update("status", CustomerStatusNone).Error
+	})
+	return sale, err
+}
+
+// ответ на ошибку оформления продажи
+func respondSaleError(c *gin.Context, err error) {
+	var saleErr *SaleError
+	if errors.As(err, &saleErr) {
+		c.JSON(saleErr.Status, gin.H{"error": saleErr.Message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при оформлении продажи"})
+}
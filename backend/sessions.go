@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// срок жизни токенов
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// Сессия пользователя: ID сессии передается в access-токене как jti,
+// refresh-токен хранится только в виде хэша и меняется при каждом обновлении
+type Session struct {
+	ID           string     `json:"id" gorm:"primaryKey"`
+	UserID       uint       `json:"userId" gorm:"index"`
+	RefreshHash  string     `json:"-" gorm:"uniqueIndex"`
+	PreviousHash string     `json:"-" gorm:"index"`
+	UserAgent    string     `json:"userAgent"`
+	IP           string     `json:"ip"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+	LastUsedAt   time.Time  `json:"lastUsedAt"`
+	RevokedAt    *time.Time `json:"revokedAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+type LogoutRequest struct {
+	All bool `json:"all"`
+}
+
+var errSessionInvalid = errors.New("сессия недействительна")
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// пара токенов для ответа клиенту
+func tokenPair(user User, session Session, refreshToken string) (gin.H, error) {
+	accessToken, err := generateToken(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"token":        accessToken,
+		"refreshToken": refreshToken,
+		"expiresIn":    int(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+// новая сессия при входе или регистрации
+func startSession(c *gin.Context, db *gorm.DB, user User) (gin.H, error) {
+	id, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := Session{
+		ID:          id,
+		UserID:      user.ID,
+		RefreshHash: hashToken(refreshToken),
+		UserAgent:   c.Request.UserAgent(),
+		IP:          c.ClientIP(),
+		ExpiresAt:   now.Add(refreshTokenTTL),
+		LastUsedAt:  now,
+		CreatedAt:   now,
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return tokenPair(user, session, refreshToken)
+}
+
+// обмен refresh-токена на новую пару; повторное использование старого токена
+// означает его утечку, поэтому сессия отзывается
+func rotateSession(db *gorm.DB, refreshToken string) (User, Session, string, error) {
+	var user User
+	var session Session
+	hash := hashToken(refreshToken)
+
+	if err := db.Where("refresh_hash = ?", hash).First(&session).Error; err != nil {
+		if db.Where("previous_hash = ?", hash).First(&session).Error == nil {
+			revokeSession(db, session.ID)
+		}
+		return user, session, "", errSessionInvalid
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return user, session, "", errSessionInvalid
+	}
+	if err := db.First(&user, session.UserID).Error; err != nil {
+		return user, session, "", errSessionInvalid
+	}
+
+	newToken, err := randomToken(32)
+	if err != nil {
+		return user, session, "", err
+	}
+	result := db.Model(&Session{}).Where("id = ? AND refresh_hash = ?", session.ID, hash).
+		Updates(map[string]interface{}{
+			"refresh_hash":  hashToken(newToken),
+			"previous_hash": hash,
+			"last_used_at":  time.Now(),
+		})
+	if result.Error != nil {
+		return user, session, "", result.Error
+	}
+	// параллельный запрос уже обновил токен
+	if result.RowsAffected == 0 {
+		return user, session, "", errSessionInvalid
+	}
+	return user, session, newToken, nil
+}
+
+func revokeSession(db *gorm.DB, sessionID string) {
+	db.Model(&Session{}).Where("id = ? AND revoked_at IS NULL", sessionID).Update("revoked_at", time.Now())
+}
+
+// отзыв всех сессий пользователя: выданные access-токены перестают
+// действовать сразу за счет новой версии токенов
+func revokeUserSessions(db *gorm.DB, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Model(&User{}).Where("id = ?", userID).
+			Update("token_version", gorm.Expr("token_version + 1")).Error
+	})
+}
+
+// проверка, что токен не отозван: версия токенов пользователя и сессия jti
+func checkTokenRevocation(db *gorm.DB, claims *JWTClaims) (User, bool) {
+	var user User
+	if err := db.Where("username = ?", claims.Username).First(&user).Error; err != nil {
+		return user, false
+	}
+	if user.TokenVersion != claims.TokenVersion || claims.ID == "" {
+		return user, false
+	}
+	var active int64
+	db.Model(&Session{}).Where("id = ? AND user_id = ? AND revoked_at IS NULL", claims.ID, user.ID).Count(&active)
+	return user, active > 0
+}
+
+func SetupSessionRoutes(r *gin.Engine, userAdminRoutes *gin.RouterGroup, db *gorm.DB) {
+
+	// обновление пары токенов
+	r.POST("/api/auth/refresh", func(c *gin.Context) {
+		var req RefreshRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		user, session, refreshToken, err := rotateSession(db, req.RefreshToken)
+		if errors.Is(err, errSessionInvalid) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Недействительный refresh-токен"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления токена"})
+			return
+		}
+		tokens, err := tokenPair(user, session, refreshToken)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания токена"})
+			return
+		}
+		c.JSON(http.StatusOK, tokens)
+	})
+
+	// выход из текущей сессии или из всех сессий пользователя
+	r.POST("/api/auth/logout", authMiddleware(), func(c *gin.Context) {
+		var req LogoutRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if req.All {
+			if err := revokeUserSessions(db, c.GetUint("userId")); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при завершении сессий"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "Все сессии завершены"})
+			return
+		}
+		revokeSession(db, c.GetString("sessionId"))
+		c.JSON(http.StatusOK, gin.H{"message": "Сессия завершена"})
+	})
+
+	// активные сессии пользователя
+	userAdminRoutes.GET("/users/:id/sessions", func(c *gin.Context) {
+		var sessions []Session
+		db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", c.Param("id"), time.Now()).
+			Order("last_used_at DESC").Find(&sessions)
+		c.JSON(http.StatusOK, sessions)
+	})
+
+	// принудительное завершение всех сессий пользователя
+	userAdminRoutes.POST("/users/:id/revoke-sessions", func(c *gin.Context) {
+		var user User
+		if err := db.First(&user, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+			return
+		}
+		if err := revokeUserSessions(db, user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при завершении сессий"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Сессии пользователя завершены"})
+	})
+}
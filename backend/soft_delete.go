@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// записи, которые ссылаются на удаляемую
+type softDeleteReference struct {
+	name   string
+	model  interface{}
+	column string
+}
+
+// сущность с мягким удалением: удаленные записи скрыты из списков,
+// их можно восстановить или удалить окончательно, если на них никто не ссылается
+type softDeleteResource struct {
+	path       string
+	newRecord  func() interface{}
+	newList    func() interface{}
+	notFound   string
+	shopScoped bool
+	references []softDeleteReference
+}
+
+var softDeleteResources = map[string]softDeleteResource{
+	"cars": {
+		path:       "cars",
+		newRecord:  func() interface{} { return &Car{} },
+		newList:    func() interface{} { return &[]Car{} },
+		notFound:   "Автомобиль не найден",
+		shopScoped: true,
+		references: []softDeleteReference{
+			{"sales", &Sale{}, "car_id"},
+			{"favorites", &Favorite{}, "car_id"},
+			{"calculations", &CostCalculation{}, "car_id"},
+		},
+	},
+	"customers": {
+		path:      "customers",
+		newRecord: func() interface{} { return &Customer{} },
+		newList:   func() interface{} { return &[]Customer{} },
+		notFound:  "Клиент не найден",
+		references: []softDeleteReference{
+			{"sales", &Sale{}, "customer_id"},
+			{"calculations", &CostCalculation{}, "customer_id"},
+			{"users", &User{}, "customer_id"},
+		},
+	},
+	"employees": {
+		path:       "employees",
+		newRecord:  func() interface{} { return &Employee{} },
+		newList:    func() interface{} { return &[]Employee{} },
+		notFound:   "Сотрудник не найден",
+		shopScoped: true,
+		references: []softDeleteReference{
+			{"sales", &Sale{}, "employee_id"},
+		},
+	},
+}
+
+// удаленные записи тоже подгружаются, чтобы история продаж и расчетов не теряла данные
+func withDeleted(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
+
+// число ссылающихся записей по таблицам, только ненулевые
+func (res softDeleteResource) referenceCounts(db *gorm.DB, id uint) (map[string]int64, error) {
+	counts := map[string]int64{}
+	for _, ref := range res.references {
+		var count int64
+		if err := db.Model(ref.model).Where(ref.column+" = ?", id).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			counts[ref.name] = count
+		}
+	}
+	return counts, nil
+}
+
+// запись, в том числе удаленная, с проверкой доступа к автосалону; при ошибке ответ уже записан
+func (res softDeleteResource) find(c *gin.Context, db *gorm.DB) (uint, *gorm.DeletedAt, bool) {
+	var row struct {
+		ID        uint
+		ShopID    uint
+		DeletedAt gorm.DeletedAt
+	}
+	columns := []string{"id", "deleted_at"}
+	if res.shopScoped {
+		columns = append(columns, "shop_id")
+	}
+	if err := db.Unscoped().Model(res.newRecord()).Select(columns).Where("id = ?", c.Param("id")).Take(&row).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": res.notFound})
+		return 0, nil, false
+	}
+	if res.shopScoped && !checkShopAccess(c, row.ShopID) {
+		return 0, nil, false
+	}
+	return row.ID, &row.DeletedAt, true
+}
+
+func (res softDeleteResource) setup(routes *gin.RouterGroup, db *gorm.DB) {
+
+	// удаленные записи, последние удаленные первыми
+	routes.GET("/"+res.path+"/deleted", func(c *gin.Context) {
+		list := res.newList()
+		query := db.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at DESC")
+		if res.shopScoped {
+			query = scopeToShop(c, query, "shop_id")
+		}
+		query.Find(list)
+		c.JSON(http.StatusOK, list)
+	})
+
+	// восстановление удаленной записи
+	routes.POST("/"+res.path+"/:id/restore", func(c *gin.Context) {
+		id, deletedAt, ok := res.find(c, db)
+		if !ok {
+			return
+		}
+		if !deletedAt.Valid {
+			c.JSON(http.StatusConflict, gin.H{"error": "Запись не удалена"})
+			return
+		}
+		if err := db.Unscoped().Model(res.newRecord()).Where("id = ?", id).Update("deleted_at", nil).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при восстановлении записи"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Запись восстановлена", "id": id})
+	})
+
+	// окончательное удаление, только без ссылающихся записей
+	routes.DELETE("/"+res.path+"/:id/purge", func(c *gin.Context) {
+		id, _, ok := res.find(c, db)
+		if !ok {
+			return
+		}
+		counts, err := res.referenceCounts(db, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки связанных записей"})
+			return
+		}
+		if len(counts) > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":      "Запись нельзя удалить окончательно: на нее ссылаются другие записи",
+				"references": counts,
+			})
+			return
+		}
+		if err := db.Unscoped().Delete(res.newRecord(), id).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при удалении записи"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Запись удалена окончательно"})
+	})
+}
+
+func SetupSoftDeleteRoutes(carRoutes, customerRoutes, employeeRoutes *gin.RouterGroup, db *gorm.DB) {
+	softDeleteResources["cars"].setup(carRoutes, db)
+	softDeleteResources["customers"].setup(customerRoutes, db)
+	softDeleteResources["employees"].setup(employeeRoutes, db)
+}
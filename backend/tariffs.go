@@ -0,0 +1,359 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+const tariffDateLayout = "2006-01-02"
+
+// ступень тарифа: значение действует, пока параметр не больше Max; Max не задан - без ограничения
+type TariffBracket struct {
+	Max   *float64 `json:"max" yaml:"max"`
+	Value float64  `json:"value" yaml:"value"`
+}
+
+// ставки пошлины по возрасту для страны, пустая страна - ставка по умолчанию
+type CustomsRule struct {
+	Country  string          `json:"country" yaml:"country"`
+	Brackets []TariffBracket `json:"brackets" yaml:"brackets"`
+}
+
+// правила расчета импорта
+type TariffRules struct {
+	VATRate              float64           `json:"vatRate" yaml:"vatRate"`
+	Customs              []CustomsRule     `json:"customs" yaml:"customs"`
+	ExciseByVolume       []TariffBracket   `json:"exciseByVolume" yaml:"exciseByVolume"`
+	ExciseAgeCoefficient []TariffBracket   `json:"exciseAgeCoefficient" yaml:"exciseAgeCoefficient"`
+	UtilizationByAge     []TariffBracket   `json:"utilizationByAge" yaml:"utilizationByAge"`
+	RegistrationByPower  []TariffBracket   `json:"registrationByPower" yaml:"registrationByPower"`
+	CountryAliases       map[string]string `json:"countryAliases" yaml:"countryAliases"`
+	Electric             *ElectricRules    `json:"electric,omitempty" yaml:"electric"`
+}
+
+// правила для электромобилей: пошлина от стоимости, акциз за кВт мощности по ступеням мощности
+type ElectricRules struct {
+	CustomsRate      float64         `json:"customsRate" yaml:"customsRate"`
+	ExciseByPower    []TariffBracket `json:"exciseByPower" yaml:"exciseByPower"`
+	UtilizationByAge []TariffBracket `json:"utilizationByAge" yaml:"utilizationByAge"`
+}
+
+// Модель тарифной таблицы
+type TariffTable struct {
+	ID            uint        `json:"id" gorm:"primaryKey"`
+	Name          string      `json:"name"`
+	EffectiveFrom time.Time   `json:"effectiveFrom" gorm:"uniqueIndex"`
+	Rules         TariffRules `json:"rules" gorm:"serializer:json"`
+	CreatedAt     time.Time   `json:"createdAt"`
+}
+
+// тарифная таблица в запросах и файлах импорта, дата в формате 2006-01-02
+type TariffInput struct {
+	Name          string      `json:"name" yaml:"name" binding:"required"`
+	EffectiveFrom string      `json:"effectiveFrom" yaml:"effectiveFrom" binding:"required"`
+	Rules         TariffRules `json:"rules" yaml:"rules"`
+}
+
+func limit(v float64) *float64 {
+	return &v
+}
+
+// тарифы, которые действовали до появления тарифных таблиц
+func defaultTariffRules() TariffRules {
+	return TariffRules{
+		VATRate: 0.20,
+		Customs: []CustomsRule{
+			{Country: "ЕС", Brackets: []TariffBracket{{limit(3), 0.15}, {limit(5), 0.20}, {limit(7), 0.25}, {nil, 0.30}}},
+			{Country: "США", Brackets: []TariffBracket{{limit(3), 0.18}, {limit(5), 0.23}, {limit(7), 0.28}, {nil, 0.33}}},
+			{Country: "", Brackets: []TariffBracket{{nil, 0.25}}},
+		},
+		ExciseByVolume: []TariffBracket{
+			{limit(1.0), 3000}, {limit(1.5), 5000}, {limit(2.0), 7000}, {limit(3.0), 9000}, {nil, 12000},
+		},
+		ExciseAgeCoefficient: []TariffBracket{{limit(5), 1.0}, {limit(10), 1.5}, {nil, 2.0}},
+		UtilizationByAge:     []TariffBracket{{limit(3), 3000}, {limit(7), 5000}, {nil, 8000}},
+		RegistrationByPower: []TariffBracket{
+			{limit(100), 2000}, {limit(150), 3000}, {limit(200), 5000}, {limit(250), 7500}, {nil, 10000},
+		},
+		CountryAliases: map[string]string{"EU": "ЕС", "USA": "США", "US": "США"},
+		Electric: &ElectricRules{
+			CustomsRate: 0.15,
+			ExciseByPower: []TariffBracket{
+				{limit(66), 0}, {limit(110), 45}, {limit(147), 820}, {limit(221), 1300}, {limit(294), 1400}, {nil, 1500},
+			},
+			UtilizationByAge: []TariffBracket{{limit(3), 3400}, {nil, 5200}},
+		},
+	}
+}
+
+// значение ступени для параметра
+func bracketValue(brackets []TariffBracket, x float64) float64 {
+	for _, b := range brackets {
+		if b.Max == nil || x <= *b.Max {
+			return b.Value
+		}
+	}
+	return 0
+}
+
+func validateBrackets(name string, brackets []TariffBracket) error {
+	if len(brackets) == 0 {
+		return fmt.Errorf("%s: нужна хотя бы одна ступень", name)
+	}
+	for i, b := range brackets {
+		last := i == len(brackets)-1
+		if b.Max == nil && !last {
+			return fmt.Errorf("%s: ступень без ограничения должна быть последней", name)
+		}
+		if b.Max != nil && last {
+			return fmt.Errorf("%s: последняя ступень должна быть без ограничения", name)
+		}
+		if i > 0 && b.Max != nil && *b.Max <= *brackets[i-1].Max {
+			return fmt.Errorf("%s: границы ступеней должны возрастать", name)
+		}
+		if b.Value < 0 {
+			return fmt.Errorf("%s: значение не может быть отрицательным", name)
+		}
+	}
+	return nil
+}
+
+type bracketCheck struct {
+	name     string
+	brackets []TariffBracket
+}
+
+// проверка правил тарифа
+func validateTariffRules(rules TariffRules) error {
+	if rules.VATRate < 0 || rules.VATRate >= 1 {
+		return errors.New("vatRate: ставка НДС задается долей от 0 до 1")
+	}
+	hasDefault := false
+	for _, rule := range rules.Customs {
+		if rule.Country == "" {
+			hasDefault = true
+		}
+		if err := validateBrackets("customs "+rule.Country, rule.Brackets); err != nil {
+			return err
+		}
+	}
+	if !hasDefault {
+		return errors.New("customs: нужна ставка по умолчанию (правило без страны)")
+	}
+	checks := []bracketCheck{
+		{"exciseByVolume", rules.ExciseByVolume},
+		{"exciseAgeCoefficient", rules.ExciseAgeCoefficient},
+		{"utilizationByAge", rules.UtilizationByAge},
+		{"registrationByPower", rules.RegistrationByPower},
+	}
+	if rules.Electric != nil {
+		if rules.Electric.CustomsRate < 0 || rules.Electric.CustomsRate >= 1 {
+			return errors.New("electric.customsRate: ставка пошлины задается долей от 0 до 1")
+		}
+		checks = append(checks,
+			bracketCheck{"electric.exciseByPower", rules.Electric.ExciseByPower},
+			bracketCheck{"electric.utilizationByAge", rules.Electric.UtilizationByAge},
+		)
+	}
+	for _, check := range checks {
+		if err := validateBrackets(check.name, check.brackets); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// преобразование входных данных в тарифную таблицу
+func (in TariffInput) toTable() (TariffTable, error) {
+	date, err := time.Parse(tariffDateLayout, in.EffectiveFrom)
+	if err != nil {
+		return TariffTable{}, fmt.Errorf("effectiveFrom: ожидается дата в формате %s", tariffDateLayout)
+	}
+	if err := validateTariffRules(in.Rules); err != nil {
+		return TariffTable{}, err
+	}
+	return TariffTable{Name: in.Name, EffectiveFrom: date, Rules: in.Rules}, nil
+}
+
+// данные для импорта: файл из поля file или тело запроса
+func readImportData(c *gin.Context) ([]byte, error) {
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+	return io.ReadAll(c.Request.Body)
+}
+
+// тариф, действовавший на дату
+func findTariff(db *gorm.DB, date time.Time) (TariffTable, error) {
+	var tariff TariffTable
+	err := db.Where("effective_from <= ?", date).Order("effective_from DESC").First(&tariff).Error
+	return tariff, err
+}
+
+// создание тарифа по умолчанию
+func createDefaultTariff(db *gorm.DB) error {
+	var count int64
+	db.Model(&TariffTable{}).Count(&count)
+	if count > 0 {
+		return nil
+	}
+	return db.Create(&TariffTable{
+		Name:          "Базовый тариф",
+		EffectiveFrom: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		Rules:         defaultTariffRules(),
+		CreatedAt:     time.Now(),
+	}).Error
+}
+
+// импорт тарифов из JSON или YAML: одна таблица или список таблиц
+func parseTariffFile(data []byte) ([]TariffInput, error) {
+	var list []TariffInput
+	if err := yaml.Unmarshal(data, &list); err == nil {
+		return list, nil
+	}
+	var single TariffInput
+	if err := yaml.Unmarshal(data, &single); err != nil {
+		return nil, fmt.Errorf("не удалось разобрать файл тарифов: %w", err)
+	}
+	return []TariffInput{single}, nil
+}
+
+// сохранение тарифов, тариф с той же датой начала действия заменяется
+func importTariffs(db *gorm.DB, inputs []TariffInput) ([]TariffTable, error) {
+	tables := make([]TariffTable, 0, len(inputs))
+	for i, in := range inputs {
+		table, err := in.toTable()
+		if err != nil {
+			return nil, fmt.Errorf("тариф %d: %w", i+1, err)
+		}
+		tables = append(tables, table)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i := range tables {
+			var existing TariffTable
+			if tx.Where("effective_from = ?", tables[i].EffectiveFrom).First(&existing).Error == nil {
+				tables[i].ID = existing.ID
+				tables[i].CreatedAt = existing.CreatedAt
+			} else {
+				tables[i].CreatedAt = time.Now()
+			}
+			if err := tx.Save(&tables[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return tables, err
+}
+
+func SetupTariffRoutes(adminRoutes *gin.RouterGroup, db *gorm.DB) {
+
+	// список тарифов
+	adminRoutes.GET("/tariffs", func(c *gin.Context) {
+		var tariffs []TariffTable
+		db.Order("effective_from DESC").Find(&tariffs)
+		c.JSON(http.StatusOK, tariffs)
+	})
+
+	adminRoutes.GET("/tariffs/:id", func(c *gin.Context) {
+		var tariff TariffTable
+		if err := db.First(&tariff, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Тариф не найден"})
+			return
+		}
+		c.JSON(http.StatusOK, tariff)
+	})
+
+	// CRUD тарифов
+	adminRoutes.POST("/tariffs", func(c *gin.Context) {
+		var input TariffInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		tariff, err := input.toTable()
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		var count int64
+		db.Model(&TariffTable{}).Where("effective_from = ?", tariff.EffectiveFrom).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Тариф с такой датой начала действия уже существует"})
+			return
+		}
+		tariff.CreatedAt = time.Now()
+		if err := db.Create(&tariff).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при создании тарифа"})
+			return
+		}
+		c.JSON(http.StatusCreated, tariff)
+	})
+
+	adminRoutes.PUT("/tariffs/:id", func(c *gin.Context) {
+		var existing TariffTable
+		if err := db.First(&existing, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Тариф не найден"})
+			return
+		}
+		var input TariffInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		tariff, err := input.toTable()
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		var count int64
+		db.Model(&TariffTable{}).Where("effective_from = ? AND id <> ?", tariff.EffectiveFrom, existing.ID).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Тариф с такой датой начала действия уже существует"})
+			return
+		}
+		tariff.ID = existing.ID
+		tariff.CreatedAt = existing.CreatedAt
+		db.Save(&tariff)
+		c.JSON(http.StatusOK, tariff)
+	})
+
+	adminRoutes.DELETE("/tariffs/:id", func(c *gin.Context) {
+		db.Delete(&TariffTable{}, c.Param("id"))
+		c.JSON(http.StatusOK, gin.H{"message": "Тариф удален"})
+	})
+
+	// импорт тарифов из файла (поле file) или из тела запроса
+	adminRoutes.POST("/tariffs/import", func(c *gin.Context) {
+		data, err := readImportData(c)
+		if err != nil || len(data) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Файл не получен"})
+			return
+		}
+
+		inputs, err := parseTariffFile(data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		tariffs, err := importTariffs(db, inputs)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, tariffs)
+	})
+}
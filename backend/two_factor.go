@@ -0,0 +1,428 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// параметры TOTP (RFC 6238), совместимые с Google Authenticator и аналогами
+const (
+	totpIssuer = "Автосалон"
+	totpDigits = 6
+	totpPeriod = 30
+	// допустимое расхождение часов: предыдущий и следующий интервал
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+	loginChallengeTTL = 5 * time.Minute
+
+	TokenPurposeLoginChallenge = "login_2fa"
+	LoginFailureBadTOTP        = "bad_totp"
+)
+
+// Одноразовый код восстановления на случай потери устройства, хранится хэш
+type RecoveryCode struct {
+	ID       uint       `json:"id" gorm:"primaryKey"`
+	UserID   uint       `json:"userId" gorm:"index"`
+	CodeHash string     `json:"-" gorm:"uniqueIndex"`
+	UsedAt   *time.Time `json:"usedAt"`
+}
+
+// Политика безопасности, одна запись на систему
+type SecurityPolicy struct {
+	ID                    uint      `json:"-" gorm:"primaryKey"`
+	RequireStaffTwoFactor bool      `json:"requireStaffTwoFactor"`
+	UpdatedAt             time.Time `json:"updatedAt"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TwoFactorDisableRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type LoginChallengeRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// обязательна ли 2FA для сотрудников, держим в памяти, чтобы не читать политику на каждый запрос
+var requireStaffTwoFactor atomic.Bool
+
+// маршруты, доступные сотруднику до подключения обязательной 2FA
+var twoFactorSetupAllowedPaths = map[string]bool{
+	"/api/auth/2fa/setup":  true,
+	"/api/auth/2fa/enable": true,
+	"/api/auth/logout":     true,
+	"/api/auth/check":      true,
+}
+
+func loadSecurityPolicy(db *gorm.DB) error {
+	var policy SecurityPolicy
+	if err := db.FirstOrCreate(&policy, SecurityPolicy{ID: 1}).Error; err != nil {
+		return err
+	}
+	requireStaffTwoFactor.Store(policy.RequireStaffTwoFactor)
+	return nil
+}
+
+// сотрудник без 2FA при обязательной политике
+func twoFactorSetupRequired(user User) bool {
+	return !user.TOTPEnabled && userRole(user) != RoleCustomer && requireStaffTwoFactor.Load()
+}
+
+func newTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf), nil
+}
+
+// ссылка otpauth:// для QR-кода в приложении-аутентификаторе
+func totpProvisioningURI(secret, username string) string {
+	label := url.PathEscape(totpIssuer + ":" + username)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// HOTP (RFC 4226) для номера интервала
+func hotp(key []byte, counter uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, code%mod)
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+}
+
+// проверка кода с учетом расхождения часов; возвращает номер интервала кода,
+// повторно код того же или более раннего интервала не принимается
+func verifyTOTP(secret, code string, lastStep int64, now time.Time) (int64, bool) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if hmac.Equal([]byte(hotp(key, uint64(step), totpDigits)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// новый набор кодов восстановления взамен прежних
+func generateRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := randomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		code := raw[:5] + "-" + raw[5:]
+		if err := tx.Create(&RecoveryCode{UserID: userID, CodeHash: hashToken(normalizeRecoveryCode(code))}).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// проверка второго фактора: код из приложения или неиспользованный код восстановления
+func checkSecondFactor(tx *gorm.DB, user *User, code string) bool {
+	code = strings.TrimSpace(code)
+	if step, ok := verifyTOTP(user.TOTPSecret, code, user.TOTPLastStep, time.Now()); ok {
+		// условие на прежний интервал не дает принять один код в параллельных запросах
+		result := tx.Model(&User{}).Where("id = ? AND totp_last_step < ?", user.ID, step).Update("totp_last_step", step)
+		user.TOTPLastStep = step
+		return result.Error == nil && result.RowsAffected == 1
+	}
+	result := tx.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+func disableTwoFactor(tx *gorm.DB, userID uint) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"totp_enabled":   false,
+		"totp_secret":    "",
+		"totp_last_step": 0,
+	}).Error
+}
+
+func currentUser(c *gin.Context, db *gorm.DB) (User, bool) {
+	var user User
+	if err := db.First(&user, c.GetUint("userId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+		return user, false
+	}
+	return user, true
+}
+
+func SetupTwoFactorRoutes(r *gin.Engine, userAdminRoutes *gin.RouterGroup, db *gorm.DB) {
+
+	// второй шаг входа: код из приложения или код восстановления
+	r.POST("/api/auth/login/2fa", func(c *gin.Context) {
+		var req LoginChallengeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var challenge UserToken
+		err := db.Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?",
+			hashToken(req.ChallengeToken), TokenPurposeLoginChallenge, time.Now()).First(&challenge).Error
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Срок подтверждения входа истек, войдите заново"})
+			return
+		}
+		var user User
+		if err := db.First(&user, challenge.UserID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Срок подтверждения входа истек, войдите заново"})
+			return
+		}
+		if remaining := loginGuard.lockedFor(db, user.Username, c.ClientIP()); remaining > 0 {
+			loginGuard.fail(c, db, user.Username, LoginFailureLocked)
+			respondLoginLocked(c, remaining)
+			return
+		}
+
+		if !checkSecondFactor(db, &user, req.Code) {
+			if locked := loginGuard.fail(c, db, user.Username, LoginFailureBadTOTP); locked > 0 {
+				respondLoginLocked(c, locked)
+				return
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверный код подтверждения"})
+			return
+		}
+		if _, err := consumeUserToken(db, req.ChallengeToken, TokenPurposeLoginChallenge); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Срок подтверждения входа истек, войдите заново"})
+			return
+		}
+		loginGuard.succeed(db, user.Username)
+		completeLogin(c, db, user)
+	})
+
+	// начало подключения: новый секрет и ссылка для QR-кода
+	r.POST("/api/auth/2fa/setup", authMiddleware(), func(c *gin.Context) {
+		user, ok := currentUser(c, db)
+		if !ok {
+			return
+		}
+		if user.TOTPEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": "Двухфакторная аутентификация уже включена"})
+			return
+		}
+		secret, err := newTOTPSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания секрета"})
+			return
+		}
+		db.Model(&user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0})
+		c.JSON(http.StatusOK, gin.H{
+			"secret": secret,
+			"uri":    totpProvisioningURI(secret, user.Username),
+		})
+	})
+
+	// подтверждение подключения первым кодом, в ответе коды восстановления (показываются один раз)
+	r.POST("/api/auth/2fa/enable", authMiddleware(), func(c *gin.Context) {
+		var req TwoFactorCodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		user, ok := currentUser(c, db)
+		if !ok {
+			return
+		}
+		if user.TOTPEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": "Двухфакторная аутентификация уже включена"})
+			return
+		}
+		if user.TOTPSecret == "" {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Сначала получите секрет через /api/auth/2fa/setup"})
+			return
+		}
+		step, valid := verifyTOTP(user.TOTPSecret, strings.TrimSpace(req.Code), user.TOTPLastStep, time.Now())
+		if !valid {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Неверный код подтверждения"})
+			return
+		}
+
+		var codes []string
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&user).Updates(map[string]interface{}{"totp_enabled": true, "totp_last_step": step}).Error; err != nil {
+				return err
+			}
+			var err error
+			codes, err = generateRecoveryCodes(tx, user.ID)
+			return err
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при включении двухфакторной аутентификации"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Двухфакторная аутентификация включена", "recoveryCodes": codes})
+	})
+
+	// новые коды восстановления, прежние перестают действовать
+	r.POST("/api/auth/2fa/recovery-codes", authMiddleware(), func(c *gin.Context) {
+		var req TwoFactorCodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		user, ok := currentUser(c, db)
+		if !ok {
+			return
+		}
+		if !user.TOTPEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": "Двухфакторная аутентификация не включена"})
+			return
+		}
+		var codes []string
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if !checkSecondFactor(tx, &user, req.Code) {
+				return errTokenInvalid
+			}
+			var err error
+			codes, err = generateRecoveryCodes(tx, user.ID)
+			return err
+		})
+		if errors.Is(err, errTokenInvalid) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Неверный код подтверждения"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания кодов восстановления"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+	})
+
+	// отключение 2FA с подтверждением паролем и кодом
+	r.POST("/api/auth/2fa/disable", authMiddleware(), func(c *gin.Context) {
+		var req TwoFactorDisableRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		user, ok := currentUser(c, db)
+		if !ok {
+			return
+		}
+		if !user.TOTPEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": "Двухфакторная аутентификация не включена"})
+			return
+		}
+		if userRole(user) != RoleCustomer && requireStaffTwoFactor.Load() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Двухфакторная аутентификация обязательна для сотрудников"})
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверный пароль"})
+			return
+		}
+		if !checkSecondFactor(db, &user, req.Code) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Неверный код подтверждения"})
+			return
+		}
+		if err := disableTwoFactor(db, user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при отключении двухфакторной аутентификации"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Двухфакторная аутентификация отключена"})
+	})
+
+	// политика безопасности
+	userAdminRoutes.GET("/security-policy", func(c *gin.Context) {
+		var policy SecurityPolicy
+		db.FirstOrCreate(&policy, SecurityPolicy{ID: 1})
+		c.JSON(http.StatusOK, policy)
+	})
+
+	userAdminRoutes.PUT("/security-policy", func(c *gin.Context) {
+		var policy SecurityPolicy
+		db.FirstOrCreate(&policy, SecurityPolicy{ID: 1})
+		if err := c.ShouldBindJSON(&policy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		policy.ID = 1
+		if err := db.Save(&policy).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при сохранении политики"})
+			return
+		}
+		requireStaffTwoFactor.Store(policy.RequireStaffTwoFactor)
+		c.JSON(http.StatusOK, policy)
+	})
+
+	// сброс 2FA пользователя, потерявшего устройство и коды восстановления
+	userAdminRoutes.POST("/users/:id/2fa/reset", func(c *gin.Context) {
+		var user User
+		if err := db.First(&user, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+			return
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := disableTwoFactor(tx, user.ID); err != nil {
+				return err
+			}
+			return revokeUserSessions(tx, user.ID)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при сбросе двухфакторной аутентификации"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Двухфакторная аутентификация пользователя сброшена"})
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// тестовые значения из приложения B RFC 6238 (SHA-1, 8 цифр)
+func TestHOTPMatchesRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tc := range cases {
+		if got := hotp(key, uint64(tc.unix/totpPeriod), 8); got != tc.code {
+			t.Errorf("время %d: код %s, ожидался %s", tc.unix, got, tc.code)
+		}
+	}
+}
+
+func TestVerifyTOTPWindowAndReplay(t *testing.T) {
+	key := []byte("12345678901234567890")
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(key)
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+
+	previous := hotp(key, uint64(step-1), totpDigits)
+	got, ok := verifyTOTP(secret, previous, 0, now)
+	if !ok || got != step-1 {
+		t.Fatalf("код предыдущего интервала не принят: %d %v", got, ok)
+	}
+	if _, ok := verifyTOTP(secret, previous, step-1, now); ok {
+		t.Error("повторно использованный код принят")
+	}
+	if _, ok := verifyTOTP(secret, hotp(key, uint64(step-2), totpDigits), 0, now); ok {
+		t.Error("принят код за пределами допустимого расхождения часов")
+	}
+	if _, ok := verifyTOTP(secret, "12345", 0, now); ok {
+		t.Error("принят код неверной длины")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import "github.com/gin-gonic/gin"
+
+// покупатель для ответа: контакты видны только ролям с правом customers:contacts
+type CustomerView struct {
+	Customer
+	Phone   *string `json:"phone,omitempty"`
+	Email   *string `json:"email,omitempty"`
+	Address *string `json:"address,omitempty"`
+}
+
+// сотрудник для ответа: зарплата видна только ролям с правом employees:salary
+type EmployeeView struct {
+	Employee
+	Salary *Money `json:"salary,omitempty"`
+}
+
+// продажа для ответа с теми же ограничениями для покупателя и сотрудника
+type SaleView struct {
+	Sale
+	Customer CustomerView `json:"customer"`
+	Employee EmployeeView `json:"employee"`
+}
+
+func canView(c *gin.Context, permission string) bool {
+	return roleHasPermission(c.GetString("role"), permission)
+}
+
+func customerViewOf(customer Customer, contacts bool) CustomerView {
+	view := CustomerView{Customer: customer}
+	if contacts {
+		view.Phone = &customer.Phone
+		view.Email = &customer.Email
+		view.Address = &customer.Address
+	}
+	return view
+}
+
+func employeeViewOf(employee Employee, salary bool) EmployeeView {
+	view := EmployeeView{Employee: employee}
+	if salary {
+		view.Salary = &employee.Salary
+	}
+	return view
+}
+
+func customerViews(c *gin.Context, customers []Customer) []CustomerView {
+	contacts := canView(c, PermCustomersContacts)
+	result := make([]CustomerView, 0, len(customers))
+	for _, customer := range customers {
+		result = append(result, customerViewOf(customer, contacts))
+	}
+	return result
+}
+
+func employeeViews(c *gin.Context, employees []Employee) []EmployeeView {
+	salary := canView(c, PermEmployeesSalary)
+	result := make([]EmployeeView, 0, len(employees))
+	for _, employee := range employees {
+		result = append(result, employeeViewOf(employee, salary))
+	}
+	return result
+}
+
+func saleViews(c *gin.Context, sales []Sale) []SaleView {
+	contacts := canView(c, PermCustomersContacts)
+	salary := canView(c, PermEmployeesSalary)
+	result := make([]SaleView, 0, len(sales))
+	for _, sale := range sales {
+		result = append(result, SaleView{
+			Sale:     sale,
+			Customer: customerViewOf(sale.Customer, contacts),
+			Employee: employeeViewOf(sale.Employee, salary),
+		})
+	}
+	return result
+}
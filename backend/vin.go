@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errVINLength     = errors.New("VIN должен состоять из 17 символов")
+	errVINCharacters = errors.New("VIN содержит недопустимые символы (I, O, Q не используются)")
+	errVINCheckDigit = errors.New("неверная контрольная цифра VIN")
+)
+
+// производитель по WMI
+type WMIInfo struct {
+	Manufacturer string `json:"manufacturer"`
+	Country      string `json:"country"`
+}
+
+// расшифровка VIN
+type VINDecodeResult struct {
+	VIN          string `json:"vin"`
+	WMI          string `json:"wmi"`
+	Manufacturer string `json:"manufacturer"`
+	Country      string `json:"country"`
+	ModelYear    int    `json:"modelYear"`
+	PlantCode    string `json:"plantCode"`
+	SerialNumber string `json:"serialNumber"`
+	BrandID      uint   `json:"brandId,omitempty"`
+	ModelID      uint   `json:"modelId,omitempty"`
+	Model        string `json:"model,omitempty"`
+}
+
+type DecodeVINRequest struct {
+	VIN string `json:"vin" binding:"required"`
+}
+
+// локальная таблица WMI
+var wmiTable = map[string]WMIInfo{
+	"WBA": {"BMW", "Германия"},
+	"WBS": {"BMW", "Германия"},
+	"WBY": {"BMW", "Германия"},
+	"X4X": {"BMW", "Россия"},
+	"WDB": {"Mercedes", "Германия"},
+	"WDC": {"Mercedes", "Германия"},
+	"WDD": {"Mercedes", "Германия"},
+	"W1K": {"Mercedes", "Германия"},
+	"W1N": {"Mercedes", "Германия"},
+	"WAU": {"Audi", "Германия"},
+	"WUA": {"Audi", "Германия"},
+	"TRU": {"Audi", "Венгрия"},
+	"WVW": {"Volkswagen", "Германия"},
+	"WVG": {"Volkswagen", "Германия"},
+	"XW8": {"Volkswagen", "Россия"},
+	"WP0": {"Porsche", "Германия"},
+	"WP1": {"Porsche", "Германия"},
+	"JTD": {"Toyota", "Япония"},
+	"JTE": {"Toyota", "Япония"},
+	"JTM": {"Toyota", "Япония"},
+	"JTN": {"Toyota", "Япония"},
+	"JTH": {"Lexus", "Япония"},
+	"JTJ": {"Lexus", "Япония"},
+	"XW7": {"Toyota", "Россия"},
+	"JHM": {"Honda", "Япония"},
+	"JN1": {"Nissan", "Япония"},
+	"JM1": {"Mazda", "Япония"},
+	"JF1": {"Subaru", "Япония"},
+	"JMB": {"Mitsubishi", "Япония"},
+	"KMH": {"Hyundai", "Южная Корея"},
+	"KNA": {"Kia", "Южная Корея"},
+	"KND": {"Kia", "Южная Корея"},
+	"XTA": {"Lada", "Россия"},
+	"VF1": {"Renault", "Франция"},
+	"VF3": {"Peugeot", "Франция"},
+	"VF7": {"Citroen", "Франция"},
+	"TMB": {"Skoda", "Чехия"},
+	"YV1": {"Volvo", "Швеция"},
+	"SAL": {"Land Rover", "Великобритания"},
+	"SAJ": {"Jaguar", "Великобритания"},
+	"ZFA": {"Fiat", "Италия"},
+	"ZFF": {"Ferrari", "Италия"},
+	"ZHW": {"Lamborghini", "Италия"},
+	"1FA": {"Ford", "США"},
+	"1FT": {"Ford", "США"},
+	"WF0": {"Ford", "Германия"},
+	"1G1": {"Chevrolet", "США"},
+	"1HG": {"Honda", "США"},
+	"4T1": {"Toyota", "США"},
+	"5YJ": {"Tesla", "США"},
+	"7SA": {"Tesla", "США"},
+	"LRW": {"Tesla", "Китай"},
+	"LGX": {"BYD", "Китай"},
+	"LVV": {"Chery", "Китай"},
+	"LGW": {"Haval", "Китай"},
+	"L6T": {"Geely", "Китай"},
+}
+
+// символы года выпуска (10-я позиция), цикл 30 лет начиная с 1980
+const vinYearCodes = "ABCDEFGHJKLMNPRSTVWXY123456789"
+
+var vinWeights = [17]int{8, 7, 6, 5, 4, 3, 2, 10, 0, 9, 8, 7, 6, 5, 4, 3, 2}
+
+// приведение VIN к каноническому виду
+func normalizeVIN(vin string) string {
+	return strings.ToUpper(strings.TrimSpace(vin))
+}
+
+// числовое значение символа VIN
+func vinTransliterate(ch byte) (int, bool) {
+	switch {
+	case ch >= '0' && ch <= '9':
+		return int(ch - '0'), true
+	case ch >= 'A' && ch <= 'H':
+		return int(ch-'A') + 1, true
+	case ch >= 'J' && ch <= 'N':
+		return int(ch-'J') + 1, true
+	case ch == 'P':
+		return 7, true
+	case ch == 'R':
+		return 9, true
+	case ch >= 'S' && ch <= 'Z':
+		return int(ch-'S') + 2, true
+	}
+	return 0, false
+}
+
+// контрольная цифра VIN (9-я позиция)
+func vinCheckDigit(vin string) (byte, error) {
+	sum := 0
+	for i := 0; i < len(vin); i++ {
+		value, ok := vinTransliterate(vin[i])
+		if !ok {
+			return 0, errVINCharacters
+		}
+		sum += value * vinWeights[i]
+	}
+	remainder := sum % 11
+	if remainder == 10 {
+		return 'X', nil
+	}
+	return byte('0' + remainder), nil
+}
+
+// проверка VIN
+func validateVIN(vin string) error {
+	if len(vin) != 17 {
+		return errVINLength
+	}
+	digit, err := vinCheckDigit(vin)
+	if err != nil {
+		return err
+	}
+	if vin[8] != digit {
+		return errVINCheckDigit
+	}
+	return nil
+}
+
+// год выпуска по 10-й позиции, берется последний год цикла не позже следующего
+func vinModelYear(code byte, now time.Time) int {
+	idx := strings.IndexByte(vinYearCodes, code)
+	if idx < 0 {
+		return 0
+	}
+	year := 1980 + idx
+	for year+30 <= now.Year()+1 {
+		year += 30
+	}
+	return year
+}
+
+// расшифровка VIN
+func decodeVIN(vin string) (VINDecodeResult, error) {
+	vin = normalizeVIN(vin)
+	if err := validateVIN(vin); err != nil {
+		return VINDecodeResult{}, err
+	}
+
+	result := VINDecodeResult{
+		VIN:          vin,
+		WMI:          vin[:3],
+		ModelYear:    vinModelYear(vin[9], time.Now()),
+		PlantCode:    vin[10:11],
+		SerialNumber: vin[11:],
+	}
+	if info, ok := wmiTable[result.WMI]; ok {
+		result.Manufacturer = info.Manufacturer
+		result.Country = info.Country
+	}
+	return result, nil
+}
+
+// проверка уникальности VIN, включая удаленные автомобили
+const vinTakenMessage = "Автомобиль с таким VIN уже существует (возможно, среди удаленных)"
+
+// нарушение уникального индекса idx_cars_vin: параллельный запрос успел сохранить тот же VIN
+func isVINConflict(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed: cars.vin")
+}
+
+func vinTaken(db *gorm.DB, vin string, exceptID uint) bool {
+	var count int64
+	db.Unscoped().Model(&Car{}).Where("vin = ? AND id <> ?", vin, exceptID).Count(&count)
+	return count > 0
+}
+
+// расшифровка VIN для формы добавления автомобиля
+func decodeVINHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req DecodeVINRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := decodeVIN(req.VIN)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+
+		if result.Manufacturer != "" {
+			var brand CarBrand
+			if db.Where("LOWER(name) = ?", strings.ToLower(result.Manufacturer)).First(&brand).Error == nil {
+				result.BrandID = brand.ID
+			}
+		}
+
+		// модель берем у уже заведенного автомобиля с тем же WMI и VDS
+		var sample Car
+		if db.Preload("Model").Where("vin LIKE ?", result.VIN[:8]+"%").
+			Order("id desc").First(&sample).Error == nil {
+			result.BrandID = sample.BrandID
+			result.ModelID = sample.ModelID
+			result.Model = sample.Model.Name
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// проверка VIN автомобиля перед сохранением, при ошибке ответ уже отправлен
+func checkCarVIN(c *gin.Context, db *gorm.DB, car *Car) bool {
+	car.VIN = normalizeVIN(car.VIN)
+	if car.VIN == "" {
+		return true
+	}
+	if err := validateVIN(car.VIN); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return false
+	}
+	if vinTaken(db, car.VIN, car.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": vinTakenMessage})
+		return false
+	}
+	return true
+}
@@ -5,7 +5,7 @@ import {
   CardMedia, Grid, Chip, Box, Dialog, DialogTitle, 
   DialogContent, DialogActions, TextField, Select, MenuItem,
   FormControl, InputLabel, IconButton, Paper, Slider, Accordion,
-  AccordionSummary, AccordionDetails, Divider
+  AccordionSummary, AccordionDetails, Divider, Pagination
 } from '@mui/material';
 import AddIcon from '@mui/icons-material/Add';
 import FilterListIcon from '@mui/icons-material/FilterList';
@@ -34,9 +34,25 @@ const getConditionLabel = (condition) => {
   }
 };
 
+// автомобилей на странице каталога
+const CARS_PAGE_SIZE = 12;
+
+// фильтры формы в параметры запроса, пустые поля не передаются
+const carQueryParams = (filters) => {
+  const params = {};
+  Object.entries(filters).forEach(([name, value]) => {
+    if (value !== '' && value !== null && value !== undefined) {
+      params[name] = ['condition', 'transmission'].includes(name) ? value : parseInt(value, 10);
+    }
+  });
+  return params;
+};
+
 const CarsPage = ({ newCar, lowMileage }) => {
   const [cars, setCars] = useState([]);
-  const [filteredCars, setFilteredCars] = useState([]);
+  const [total, setTotal] = useState(0);
+  const [page, setPage] = useState(1);
+  const [sort, setSort] = useState('');
   const [shops, setShops] = useState([]);
   const [brands, setBrands] = useState([]);
   const [models, setModels] = useState([]);
@@ -80,15 +96,23 @@ const CarsPage = ({ newCar, lowMileage }) => {
   const navigate = useNavigate();
 
   useEffect(() => {
-    loadCars();
     loadShops();
     loadBrands();
     
     if (authService.isAuthenticated()) {
       loadFavorites();
     }
+  }, []);
+
+  useEffect(() => {
+    setPage(1);
   }, [newCar, lowMileage]);
 
+  // фильтрация, сортировка и постраничная выдача выполняются на сервере
+  useEffect(() => {
+    loadCars();
+  }, [newCar, lowMileage, filters, sort, page]);
+
   useEffect(() => {
     if (currentCar.brandId) {
       loadModelsByBrand(currentCar.brandId);
@@ -103,26 +127,24 @@ const CarsPage = ({ newCar, lowMileage }) => {
     }
   }, [filters.brandId]);
 
-  useEffect(() => {
-    if (cars.length > 0) {
-      applyFilters();
-    }
-  }, [cars, filters]);
-
   const loadCars = async () => {
     setLoading(true);
     try {
+      const params = { ...carQueryParams(filters), page, limit: CARS_PAGE_SIZE };
+      if (sort) {
+        params.sort = sort;
+      }
       let response;
       if (newCar) {
-        response = await carService.getNewCars();
+        response = await carService.getNewCars(params);
       } else if (lowMileage) {
-        response = await carService.getLowMileageCars();
+        response = await carService.getLowMileageCars(params);
       } else {
-        response = await carService.getAllCars();
+        response = await carService.getCars(params);
       }
-      const carsData = response.data;
-      setCars(carsData);
-      setFilteredCars(carsData);
+      setCars(response.data);
+      setTotal(response.total);
+      setError('');
     } catch (err) {
       setError('Ошибка при загрузке списка автомобилей');
       console.error(err);
@@ -170,44 +192,6 @@ const CarsPage = ({ newCar, lowMileage }) => {
     }
   };
 
-  const applyFilters = () => {
-    let filtered = [...cars];
-    
-    if (filters.brandId) {
-      filtered = filtered.filter(car => car.brandId.toString() === filters.brandId.toString());
-    }
-    
-    if (filters.modelId) {
-      filtered = filtered.filter(car => car.modelId.toString() === filters.modelId.toString());
-    }
-    
-    if (filters.yearFrom) {
-      filtered = filtered.filter(car => car.year >= filters.yearFrom);
-    }
-    
-    if (filters.yearTo) {
-      filtered = filtered.filter(car => car.year <= filters.yearTo);
-    }
-    
-    if (filters.priceFrom) {
-      filtered = filtered.filter(car => car.price >= filters.priceFrom);
-    }
-    
-    if (filters.priceTo) {
-      filtered = filtered.filter(car => car.price <= filters.priceTo);
-    }
-    
-    if (filters.condition) {
-      filtered = filtered.filter(car => car.condition === filters.condition);
-    }
-
-    if (filters.transmission) {
-      filtered = filtered.filter(car => car.transmission === filters.transmission);
-    }
-    
-    setFilteredCars(filtered);
-  };
-
   const resetFilters = () => {
     setFilters({
       brandId: '',
@@ -219,7 +203,7 @@ const CarsPage = ({ newCar, lowMileage }) => {
       condition: '',
       transmission: ''
     });
-    setFilteredCars(cars);
+    setPage(1);
   };
 
   const handleFilterChange = (e) => {
@@ -228,6 +212,12 @@ const CarsPage = ({ newCar, lowMileage }) => {
       ...filters,
       [name]: value
     });
+    setPage(1);
+  };
+
+  const handleSortChange = (e) => {
+    setSort(e.target.value);
+    setPage(1);
   };
 
   const handleOpenDialog = () => {
@@ -504,6 +494,18 @@ const CarsPage = ({ newCar, lowMileage }) => {
         >
           Фильтры
         </Button>
+
+        <FormControl size="small" sx={{ ml: 1, minWidth: 200 }}>
+          <InputLabel>Сортировка</InputLabel>
+          <Select value={sort} onChange={handleSortChange} label="Сортировка">
+            <MenuItem value="">По умолчанию</MenuItem>
+            <MenuItem value="price">Сначала дешевле</MenuItem>
+            <MenuItem value="-price">Сначала дороже</MenuItem>
+            <MenuItem value="-year">Сначала новее</MenuItem>
+            <MenuItem value="mileage">Меньше пробег</MenuItem>
+            <MenuItem value="-arrivalDate">Недавно поступившие</MenuItem>
+          </Select>
+        </FormControl>
       </div>
 
       {/* фильтры */}
@@ -648,7 +650,7 @@ const CarsPage = ({ newCar, lowMileage }) => {
                     Сбросить фильтры
                   </Button>
                   <Typography variant="body2" sx={{ mt: 1 }}>
-                    Найдено автомобилей: {filteredCars.length}
+                    Найдено автомобилей: {total}
                   </Typography>
                 </Grid>
               </Grid>
@@ -661,11 +663,11 @@ const CarsPage = ({ newCar, lowMileage }) => {
         <Typography>Загрузка...</Typography>
       ) : error ? (
         <Typography color="error">{error}</Typography>
-      ) : filteredCars.length === 0 ? (
+      ) : cars.length === 0 ? (
         <Typography>Нет автомобилей для отображения</Typography>
       ) : (
         <div className="card-grid">
-          {filteredCars.map((car) => (
+          {cars.map((car) => (
             <Card key={car.id} className="card-grid-item">
               <div style={{ display: 'flex', flexDirection: 'column', width: '100%' }}>
                 <CardMedia
@@ -721,6 +723,17 @@ const CarsPage = ({ newCar, lowMileage }) => {
         </div>
       )}
 
+      {total > CARS_PAGE_SIZE && (
+        <Box sx={{ display: 'flex', justifyContent: 'center', mt: 3 }}>
+          <Pagination
+            count={Math.ceil(total / CARS_PAGE_SIZE)}
+            page={page}
+            onChange={(e, value) => setPage(value)}
+            color="primary"
+          />
+        </Box>
+      )}
+
       {/* добавление авто */}
       <Dialog open={openDialog} onClose={handleCloseDialog} maxWidth="sm" fullWidth>
         <DialogTitle>Добавить новый автомобиль</DialogTitle>
@@ -15,6 +15,8 @@ import { authService } from '../services/api';
 
 const LoginPage = () => {
   const [credentials, setCredentials] = useState({ username: '', password: '' });
+  const [challenge, setChallenge] = useState(null);
+  const [code, setCode] = useState('');
   const [error, setError] = useState('');
   const [loading, setLoading] = useState(false);
   const navigate = useNavigate();
@@ -36,8 +38,15 @@ const LoginPage = () => {
     setError('');
     setLoading(true);
     try {
-      const response = await authService.login(credentials);
+      const response = challenge
+        ? await authService.loginTwoFactor(challenge, code)
+        : await authService.login(credentials);
+      if (response.data.twoFactorRequired) {
+        setChallenge(response.data.challengeToken);
+        return;
+      }
       localStorage.setItem('token', response.data.token);
+      localStorage.setItem('refreshToken', response.data.refreshToken);
       localStorage.setItem('user', JSON.stringify(response.data.user));
       navigate('/');
     } catch (err) {
@@ -75,6 +84,19 @@ const LoginPage = () => {
           )}
 
           <form onSubmit={handleSubmit}>
+            {challenge ? (
+              <TextField
+                fullWidth
+                label="Код из приложения или код восстановления"
+                name="code"
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+                margin="normal"
+                required
+                autoFocus
+              />
+            ) : (
+            <>
             <TextField
               fullWidth
               label="Имя пользователя"
@@ -96,6 +118,8 @@ const LoginPage = () => {
               margin="normal"
               required
             />
+            </>
+            )}
 
             <Button
               type="submit"
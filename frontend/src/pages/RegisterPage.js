@@ -91,6 +91,7 @@ const RegisterPage = () => {
       const { confirmPassword, ...registerData } = userData;
       const response = await authService.register(registerData);
       localStorage.setItem('token', response.data.token);
+      localStorage.setItem('refreshToken', response.data.refreshToken);
       localStorage.setItem('user', JSON.stringify(response.data.user));
       
       navigate('/');
@@ -22,14 +22,88 @@ api.interceptors.request.use(
   }
 );
 
+// денежные суммы приходят строками с копейками ("1234.50"), для отображения переводим в числа
+const moneyFields = new Set([
+  'price', 'maxPrice', 'salary', 'salePrice', 'refundAmount', 'totalRevenue',
+  'totalCarPrice', 'totalCustomerBudget', 'carPrice', 'carPriceRub', 'customsFee',
+  'exciseTax', 'vat', 'utilizationFee', 'registrationFee', 'totalCost', 'amount',
+  'originalAmount', 'downPayment', 'tradeInValue', 'insuranceCost', 'monthlyPayment',
+  'monthlyLoanPayment', 'totalMonthlyPayment', 'loanAmount', 'totalInterest',
+  'overpayment', 'residualValue', 'balloonPayment', 'excessMileageCost',
+  'excessMileageFee', 'payment', 'interestPart', 'principalPart', 'insurancePayment',
+  'earlyRepayment', 'remainingBalance', 'initialPrice', 'fuelCost', 'serviceCost',
+  'taxCost', 'energyPrice', 'depreciation', 'resaleValue', 'netCost', 'valueAtEnd',
+  'originalPayment', 'originalTotalInterest', 'lastPayment', 'interestSaved',
+  'savedPayment', 'currentPayment', 'currentCarPrice',
+]);
+
+const parseMoney = (data) => {
+  if (Array.isArray(data)) {
+    return data.map(parseMoney);
+  }
+  if (data && typeof data === 'object') {
+    Object.keys(data).forEach((key) => {
+      if (moneyFields.has(key) && typeof data[key] === 'string') {
+        data[key] = Number(data[key]);
+      } else {
+        data[key] = parseMoney(data[key]);
+      }
+    });
+  }
+  return data;
+};
+
+const clearSession = () => {
+  localStorage.removeItem('token');
+  localStorage.removeItem('refreshToken');
+  localStorage.removeItem('user');
+};
+
+// access-токен живет 15 минут, по истечении один раз обновляем пару токенов
+// и повторяем запрос; параллельные запросы ждут одно обновление
+let refreshing = null;
+
+const refreshTokens = () => {
+  if (!refreshing) {
+    const refreshToken = localStorage.getItem('refreshToken');
+    refreshing = axios.post(`${API_URL}/auth/refresh`, { refreshToken })
+      .then(({ data }) => {
+        localStorage.setItem('token', data.token);
+        localStorage.setItem('refreshToken', data.refreshToken);
+        return data.token;
+      })
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+};
+
 api.interceptors.response.use(
   (response) => {
+    response.data = parseMoney(response.data);
     return response;
   },
   (error) => {
+    const original = error.config;
     if (error.response && error.response.status === 401) {
-      localStorage.removeItem('token');
-      localStorage.removeItem('user');
+      if (original && original.url.startsWith('/auth/logout')) {
+        return Promise.reject(error);
+      }
+      if (original && !original._retry && !original.url.startsWith('/auth/') && localStorage.getItem('refreshToken')) {
+        original._retry = true;
+        return refreshTokens()
+          .then((token) => {
+            original.headers['Authorization'] = `Bearer ${token}`;
+            return api(original);
+          })
+          .catch(() => {
+            clearSession();
+            window.location.href = '/login';
+            return Promise.reject(error);
+          });
+      }
+      clearSession();
       window.location.href = '/login';
     }
     return Promise.reject(error);
@@ -42,9 +116,24 @@ export const authService = {
   register: (userData) => api.post('/auth/register', userData),
   checkAuth: () => api.get('/auth/check'),
   logout: () => {
-    localStorage.removeItem('token');
-    localStorage.removeItem('user');
+    const token = localStorage.getItem('token');
+    if (token) {
+      api.post('/auth/logout', null, { headers: { Authorization: `Bearer ${token}` } }).catch(() => {});
+    }
+    clearSession();
   },
+  logoutAll: () => api.post('/auth/logout', { all: true }).finally(clearSession),
+  verifyEmail: (token) => api.post('/auth/verify-email', { token }),
+  resendVerification: () => api.post('/auth/resend-verification'),
+  forgotPassword: (email) => api.post('/auth/forgot-password', { email }),
+  resetPassword: (token, password) => api.post('/auth/reset-password', { token, password }),
+  changePassword: (currentPassword, newPassword) =>
+    api.post('/auth/change-password', { currentPassword, newPassword }),
+  loginTwoFactor: (challengeToken, code) => api.post('/auth/login/2fa', { challengeToken, code }),
+  setupTwoFactor: () => api.post('/auth/2fa/setup'),
+  enableTwoFactor: (code) => api.post('/auth/2fa/enable', { code }),
+  regenerateRecoveryCodes: (code) => api.post('/auth/2fa/recovery-codes', { code }),
+  disableTwoFactor: (password, code) => api.post('/auth/2fa/disable', { password, code }),
   getCurrentUser: () => {
     const user = localStorage.getItem('user');
     return user ? JSON.parse(user) : null;
@@ -56,17 +145,54 @@ export const authService = {
     const user = localStorage.getItem('user');
     return user ? JSON.parse(user).isAdmin : false;
   },
+  getRole: () => {
+    const user = localStorage.getItem('user');
+    return user ? JSON.parse(user).role || 'customer' : null;
+  },
+};
+
+// максимальный размер страницы на сервере
+const MAX_CARS_LIMIT = 100;
+
+// одна страница списка автомобилей: page/limit или cursor задает вызывающий
+const getCarsPage = (url, params) =>
+  api.get(url, { params })
+    .then((response) => ({
+      ...response,
+      data: response.data.items,
+      total: response.data.total,
+      page: response.data.page,
+      limit: response.data.limit,
+      nextCursor: response.data.nextCursor,
+    }));
+
+// весь список по курсору, для сводок по всем автомобилям (статистика автосалонов, подбор для клиента)
+const getAllCarPages = async (url, params) => {
+  const first = await getCarsPage(url, { ...params, limit: MAX_CARS_LIMIT });
+  let items = first.data;
+  let cursor = first.nextCursor;
+  while (cursor) {
+    const next = await getCarsPage(url, { ...params, limit: MAX_CARS_LIMIT, cursor });
+    items = items.concat(next.data);
+    cursor = next.nextCursor;
+  }
+  return { ...first, data: items, nextCursor: undefined };
 };
 
 // автомобили
 export const carService = {
-  getAllCars: () => api.get('/cars'),
+  getCars: (params) => getCarsPage('/cars', params),
+  getAllCars: (params) => getAllCarPages('/cars', params),
   getCarById: (id) => api.get(`/cars/${id}`),
   createCar: (car) => api.post('/admin/cars', car),
   updateCar: (id, car) => api.put(`/admin/cars/${id}`, car),
   deleteCar: (id) => api.delete(`/admin/cars/${id}`),
-  getNewCars: () => api.get('/cars/new'),
-  getLowMileageCars: () => api.get('/cars/low-mileage'),
+  getDeletedCars: () => api.get('/admin/cars/deleted'),
+  restoreCar: (id) => api.post(`/admin/cars/${id}/restore`),
+  purgeCar: (id) => api.delete(`/admin/cars/${id}/purge`),
+  decodeVIN: (vin) => api.post('/admin/cars/decode-vin', { vin }),
+  getNewCars: (params) => getCarsPage('/cars/new', params),
+  getLowMileageCars: (params) => getCarsPage('/cars/low-mileage', params),
   getMostExpensiveCar: () => api.get('/cars/most-expensive'),
 };
 
@@ -77,6 +203,9 @@ export const customerService = {
   createCustomer: (customer) => api.post('/admin/customers', customer),
   updateCustomer: (id, customer) => api.put(`/admin/customers/${id}`, customer),
   deleteCustomer: (id) => api.delete(`/admin/customers/${id}`),
+  getDeletedCustomers: () => api.get('/admin/customers/deleted'),
+  restoreCustomer: (id) => api.post(`/admin/customers/${id}/restore`),
+  purgeCustomer: (id) => api.delete(`/admin/customers/${id}/purge`),
   getCustomersByModel: (model) => api.get(`/customers/by-model?model=${model}`),
   getCustomersForCar: (carId) => api.get(`/customers/match-car/${carId}`),
 };
@@ -107,6 +236,21 @@ export const calculatorService = {
   calculateMonthlyPayment: (data) => api.post('/calculator/monthly-payment', data),
   calculateTotalCost: (data) => api.post('/calculator/total-cost', data),
   calculateImport: (data) => api.post('/calculator/import', data),
+  calculateEarlyRepayment: (data) => api.post('/calculator/early-repayment', data),
+  calculateSavedEarlyRepayment: (calculationId, data) =>
+    api.post(`/calculator/calculations/${calculationId}/early-repayment`, data),
+  getCalculations: (params) => api.get('/calculator/calculations', { params }),
+  getCalculationById: (id) => api.get(`/calculator/calculations/${id}`),
+  compareCalculations: (ids) => api.get('/calculator/calculations/compare', { params: { ids: ids.join(',') } }),
+};
+
+// варианты финансирования
+export const financeOptionService = {
+  getAllFinanceOptions: () => api.get('/finance-options'),
+  getFinanceOptionById: (id) => api.get(`/finance-options/${id}`),
+  createFinanceOption: (option) => api.post('/admin/finance-options', option),
+  updateFinanceOption: (id, option) => api.put(`/admin/finance-options/${id}`, option),
+  deleteFinanceOption: (id) => api.delete(`/admin/finance-options/${id}`),
 };
 
 // рыночная статистика
@@ -121,6 +265,9 @@ export const employeeService = {
   createEmployee: (employee) => api.post('/admin/employees', employee),
   updateEmployee: (id, employee) => api.put(`/admin/employees/${id}`, employee),
   deleteEmployee: (id) => api.delete(`/admin/employees/${id}`),
+  getDeletedEmployees: () => api.get('/admin/employees/deleted'),
+  restoreEmployee: (id) => api.post(`/admin/employees/${id}/restore`),
+  purgeEmployee: (id) => api.delete(`/admin/employees/${id}/purge`),
 };
 
 // продажи
@@ -128,6 +275,7 @@ export const saleService = {
   getAllSales: () => api.get('/sales'),
   getSaleById: (id) => api.get(`/sales/${id}`),
   createSale: (sale) => api.post('/admin/sales', sale),
+  cancelSale: (id, data) => api.post(`/admin/sales/${id}/cancel`, data),
 };
 
 // избранные автомобили
@@ -138,4 +286,35 @@ export const favoriteService = {
   checkIsFavorite: (carId) => api.get(`/user/favorites/${carId}`),
 };
 
+// личный кабинет покупателя
+export const customerPortalService = {
+  getProfile: () => api.get('/user/profile'),
+  getPreferences: () => api.get('/user/preferences'),
+  updatePreferences: (preferences) => api.put('/user/preferences', preferences),
+  getCalculations: () => api.get('/user/calculations'),
+  getSales: () => api.get('/user/sales'),
+};
+
+// роли пользователей
+export const roleService = {
+  getRoles: () => api.get('/admin/roles'),
+  getUsers: (params) => api.get('/admin/users', { params }),
+  setUserRole: (id, role, shopId) => api.put(`/admin/users/${id}/role`, { role, shopId }),
+  getUserSessions: (id) => api.get(`/admin/users/${id}/sessions`),
+  revokeUserSessions: (id) => api.post(`/admin/users/${id}/revoke-sessions`),
+  unlockUser: (id) => api.post(`/admin/users/${id}/unlock`),
+  getLoginAttempts: (params) => api.get('/admin/login-attempts', { params }),
+  getLoginLocks: () => api.get('/admin/login-locks'),
+  removeLoginLock: (id) => api.delete(`/admin/login-locks/${id}`),
+  resetUserTwoFactor: (id) => api.post(`/admin/users/${id}/2fa/reset`),
+  getSecurityPolicy: () => api.get('/admin/security-policy'),
+  updateSecurityPolicy: (policy) => api.put('/admin/security-policy', policy),
+};
+
+// журнал изменений
+export const auditService = {
+  getEntries: (params) => api.get('/admin/audit', { params }),
+  verify: () => api.get('/admin/audit/verify'),
+};
+
 export default api; 
\ No newline at end of file